@@ -10,5 +10,9 @@ type Chart struct {
 
 type Repoes struct {
 	ImageName string
+	// Organization hosting the repository, empty to search all configured organizations
+	Organization string
+	// URLs hinting at the organization of the repository: the image of the component and the sources and home of its chart
+	Sources []string
 	Chart
 }
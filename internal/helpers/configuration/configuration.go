@@ -3,24 +3,67 @@ package configuration
 import (
 	"flag"
 	"strings"
+	"time"
 
 	"github.com/krateoplatformops/snowplow/plumbing/env"
 	"github.com/rs/zerolog/log"
 )
 
 type Configuration struct {
-	InstallerChartRegistry         string   `json:"installerChartRegistry" yaml:"installerChartRegistry"`
-	InstallerChartRepository       string   `json:"installerChartRepository" yaml:"installerChartRepository"`
-	InstallerChartGithubRepository string   `json:"installerChartGithubRepository" yaml:"installerChartGithubRepository"`
-	InstallerChartVersion          string   `json:"installerChartVersion" yaml:"installerChartVersion"`
-	InstallerChartVersionPrevious  string   `json:"installerChartVersionPrevious" yaml:"installerChartVersionPrevious"`
-	Tokens                         []string `json:"token" yaml:"token"`
-	InstallerOrganization          string   `json:"installerOrganization" yaml:"installerOrganization"`
-	Organizations                  []string `json:"organization" yaml:"organizations"`
-	KrateoRepository               string   `json:"krateoRepository" yaml:"krateoRepository"`
+	Mode                           string            `json:"mode" yaml:"mode"`
+	InstallerChartRegistry         string            `json:"installerChartRegistry" yaml:"installerChartRegistry"`
+	InstallerChartRepository       string            `json:"installerChartRepository" yaml:"installerChartRepository"`
+	InstallerChartGithubRepository string            `json:"installerChartGithubRepository" yaml:"installerChartGithubRepository"`
+	InstallerChartVersion          string            `json:"installerChartVersion" yaml:"installerChartVersion"`
+	InstallerChartPath             string            `json:"installerChartPath" yaml:"installerChartPath"`
+	InstallerChartVersionPrevious  string            `json:"installerChartVersionPrevious" yaml:"installerChartVersionPrevious"`
+	Tokens                         map[string]string `json:"token" yaml:"token"`
+	GithubAppID                    int               `json:"githubAppID" yaml:"githubAppID"`
+	GithubAppPrivateKeyFile        string            `json:"githubAppPrivateKeyFile" yaml:"githubAppPrivateKeyFile"`
+	GithubAppPrivateKey            string            `json:"-" yaml:"-"`
+	GithubMaxRetries               int               `json:"githubMaxRetries" yaml:"githubMaxRetries"`
+	GithubMaxWait                  time.Duration     `json:"githubMaxWait" yaml:"githubMaxWait"`
+	InstallerOrganization          string            `json:"installerOrganization" yaml:"installerOrganization"`
+	Organizations                  []string          `json:"organization" yaml:"organizations"`
+	KrateoRepository               string            `json:"krateoRepository" yaml:"krateoRepository"`
+	RegistryURL                    string            `json:"registryURL" yaml:"registryURL"`
+	RegistryUsername               string            `json:"registryUsername" yaml:"registryUsername"`
+	RegistryToken                  string            `json:"registryToken" yaml:"registryToken"`
+	RegistryCertFile               string            `json:"registryCertFile" yaml:"registryCertFile"`
+	RegistryKeyFile                string            `json:"registryKeyFile" yaml:"registryKeyFile"`
+	RegistryCAFile                 string            `json:"registryCAFile" yaml:"registryCAFile"`
+	RegistryInsecureSkipTLSVerify  bool              `json:"registryInsecureSkipTLSVerify" yaml:"registryInsecureSkipTLSVerify"`
+	RegistryPlainHTTP              bool              `json:"registryPlainHTTP" yaml:"registryPlainHTTP"`
+	RegistriesConfig               string            `json:"registriesConfig" yaml:"registriesConfig"`
+	PullConcurrency                int               `json:"pullConcurrency" yaml:"pullConcurrency"`
+	PullTimeout                    time.Duration     `json:"pullTimeout" yaml:"pullTimeout"`
+	KeepWorkspace                  bool              `json:"keepWorkspace" yaml:"keepWorkspace"`
+	ChartCache                     bool              `json:"chartCache" yaml:"chartCache"`
+	ChartCacheDir                  string            `json:"chartCacheDir" yaml:"chartCacheDir"`
+	ChartCacheMaxSize              int               `json:"chartCacheMaxSize" yaml:"chartCacheMaxSize"`
+	Offline                        bool              `json:"offline" yaml:"offline"`
+	ValuesSchema                   string            `json:"valuesSchema" yaml:"valuesSchema"`
+	RepositoriesMapping            string            `json:"repositoriesMapping" yaml:"repositoriesMapping"`
+	ShowUnchanged                  bool              `json:"showUnchanged" yaml:"showUnchanged"`
+	AllowDowngrade                 bool              `json:"allowDowngrade" yaml:"allowDowngrade"`
+	Strict                         bool              `json:"strict" yaml:"strict"`
+	IncludePrereleases             bool              `json:"includePrereleases" yaml:"includePrereleases"`
+	BackfillDir                    string            `json:"backfillDir" yaml:"backfillDir"`
+	RebuildReleaseNotes            bool              `json:"rebuildReleaseNotes" yaml:"rebuildReleaseNotes"`
+	DryRun                         bool              `json:"dryRun" yaml:"dryRun"`
+	ReleaseDraft                   bool              `json:"releaseDraft" yaml:"releaseDraft"`
+	ReleasePrerelease              string            `json:"releasePrerelease" yaml:"releasePrerelease"`
+	MakeLatest                     string            `json:"makeLatest" yaml:"makeLatest"`
+	PullRequest                    bool              `json:"pullRequest" yaml:"pullRequest"`
+	PullRequestBranch              string            `json:"pullRequestBranch" yaml:"pullRequestBranch"`
+	PullRequestLabels              []string          `json:"pullRequestLabels" yaml:"pullRequestLabels"`
+	PullRequestReviewers           []string          `json:"pullRequestReviewers" yaml:"pullRequestReviewers"`
 }
 
 func ParseConfig() Configuration {
+	mode := flag.String("mode",
+		env.String("MODE", "release"), "release to publish the notes of a single installer version, range to combine the notes of every version between two versions, backfill to regenerate the notes of every published version, promote to publish the draft release of a version")
+
 	installerChartRegistry := flag.String("installerchartregistry",
 		env.String("INSTALLER_CHART_REGISTRY", "https://charts.krateo.io/"), "Installer Chart Registry")
 
@@ -33,13 +76,32 @@ func ParseConfig() Configuration {
 	installerChartVersion := flag.String("installerchartversion",
 		env.String("INSTALLER_CHART_VERSION", "2.5.1"), "Installer Chart Version")
 
+	installerChartPath := flag.String("installerchartpath",
+		env.String("INSTALLER_CHART_PATH", ""), "Local installer chart directory or .tgz archive to use instead of pulling the current version")
+
 	installerChartVersionPrevious := flag.String("installerchartversionprevious",
-		env.String("INSTALLER_CHART_VERSION_PREVIOUS", "2.5.0"), "Installer Chart Version to generate the release notes from")
+		env.String("INSTALLER_CHART_VERSION_PREVIOUS", ""), "Installer Chart Version to generate the release notes from, defaults to the published version preceding the current one")
+
+	includePrereleases := flag.Bool("includeprereleases",
+		env.Bool("INCLUDE_PRERELEASES", false), "Consider pre-releases when choosing the previous installer version")
 
 	tokens := flag.String("token",
-		env.String("TOKEN", ""), "GitHub bearer/app token for the API")
+		env.String("TOKEN", ""), "Comma separated list of organization=token pairs for the GitHub API, a token without organization is used for all organizations")
+
+	githubAppID := flag.Int("githubappid",
+		env.Int("GITHUB_APP_ID", 0), "GitHub App ID used to authenticate the organizations without token")
+
+	githubAppPrivateKeyFile := flag.String("githubappprivatekeyfile",
+		env.String("GITHUB_APP_PRIVATE_KEY_FILE", ""), "File with the PEM private key of the GitHub App")
+
+	githubAppPrivateKey := flag.String("githubappprivatekey",
+		env.String("GITHUB_APP_PRIVATE_KEY", ""), "PEM private key of the GitHub App, if no file is set")
+
+	githubMaxRetries := flag.Int("githubmaxretries",
+		env.Int("GITHUB_MAX_RETRIES", 5), "Maximum number of retries of a GitHub request failed because of rate limits or transient errors")
 
-	tokenList := strings.Split(*tokens, ",")
+	githubMaxWait := flag.Duration("githubmaxwait",
+		env.Duration("GITHUB_MAX_WAIT", 15*time.Minute), "Longest wait before retrying a GitHub request, e.g., for the rate limit to reset")
 
 	installerOrganization := flag.String("installerorganization",
 		env.String("INSTALLER_ORGANIZATION", "krateoplatformops"), "GitHub Organization to get/publish release notes for the installer")
@@ -48,27 +110,202 @@ func ParseConfig() Configuration {
 		env.String("ORGANIZATIONS", "krateoplatformops,krateoplatformops-blueprints"), "Comma separetaed list of GitHub Organization to retrieve release notes from")
 	log.Logger.Debug().Msgf("List of organizations: %s", *organization)
 
-	organizations := strings.Split(*organization, ",")
-	log.Logger.Debug().Msgf("Parsed list of organizations: %s", organizations)
-
 	krateoRepository := flag.String("krateorepository",
 		env.String("KRATEO_REPOSITORY", "krateo"), "Repository to append the release notes in /RELEASE_NOTES.md")
 
+	registryURL := flag.String("registryurl",
+		env.String("REGISTRY_URL", ""), "Chart registry URL prefix the registry credentials and TLS settings apply to, the host of the installer chart registry if empty")
+
+	registryUsername := flag.String("registryusername",
+		env.String("REGISTRY_USERNAME", ""), "Username for the chart registries")
+
+	registryToken := flag.String("registrytoken",
+		env.String("REGISTRY_TOKEN", ""), "Password or token for the chart registries, anonymous pulls if empty")
+
+	registryCertFile := flag.String("registrycertfile",
+		env.String("REGISTRY_CERT_FILE", ""), "Client certificate file for the chart registries")
+
+	registryKeyFile := flag.String("registrykeyfile",
+		env.String("REGISTRY_KEY_FILE", ""), "Client key file for the chart registries")
+
+	registryCAFile := flag.String("registrycafile",
+		env.String("REGISTRY_CA_FILE", ""), "CA bundle to verify the chart registries certificates")
+
+	registryInsecureSkipTLSVerify := flag.Bool("registryinsecureskiptlsverify",
+		env.Bool("REGISTRY_INSECURE_SKIP_TLS_VERIFY", false), "Skip the verification of the chart registries certificates")
+
+	registryPlainHTTP := flag.Bool("registryplainhttp",
+		env.Bool("REGISTRY_PLAIN_HTTP", false), "Use plain HTTP for the OCI chart registries")
+
+	registriesConfig := flag.String("registriesconfig",
+		env.String("REGISTRIES_CONFIG", ""), "File with per-registry credentials and TLS settings")
+
+	pullConcurrency := flag.Int("pullconcurrency",
+		env.Int("PULL_CONCURRENCY", 8), "Maximum number of component charts pulled at the same time")
+
+	pullTimeout := flag.Duration("pulltimeout",
+		env.Duration("PULL_TIMEOUT", 2*time.Minute), "Maximum duration of a single chart pull, 0 to disable")
+
+	keepWorkspace := flag.Bool("keepworkspace",
+		env.Bool("KEEP_WORKSPACE", false), "Keep the temporary directory with the downloaded charts for debugging")
+
+	chartCache := flag.Bool("chartcache",
+		env.Bool("CHART_CACHE", true), "Cache pulled charts on disk")
+
+	chartCacheDir := flag.String("chartcachedir",
+		env.String("CHART_CACHE_DIR", ""), "Chart cache directory, defaults to the user cache directory")
+
+	chartCacheMaxSize := flag.Int("chartcachemaxsize",
+		env.Int("CHART_CACHE_MAX_SIZE", 1024), "Maximum size of the chart cache in MB, 0 for no limit")
+
+	offline := flag.Bool("offline",
+		env.Bool("OFFLINE", false), "Only use cached charts, failing on cache misses")
+
+	valuesSchema := flag.String("valuesschema",
+		env.String("VALUES_SCHEMA", ""), "Mapping file describing where components are declared in the installer values, defaults to the Krateo installer layout")
+
+	repositoriesMapping := flag.String("repositoriesmapping",
+		env.String("REPOSITORIES_MAPPING", ""), "Mapping file (YAML, JSON or ConfigMap) of the repositories of components without image, merged with the built-in defaults")
+
+	showUnchanged := flag.Bool("showunchanged",
+		env.Bool("SHOW_UNCHANGED", false), "List the components with the same version in an Unchanged Charts section")
+
+	allowDowngrade := flag.Bool("allowdowngrade",
+		env.Bool("ALLOW_DOWNGRADE", false), "Publish the release even if some components were downgraded")
+
+	backfillDir := flag.String("backfilldir",
+		env.String("BACKFILL_DIR", "release_notes"), "Directory where the backfill mode writes the release notes of each version")
+
+	rebuildReleaseNotes := flag.Bool("rebuildreleasenotes",
+		env.Bool("REBUILD_RELEASE_NOTES", false), "Replace RELEASE_NOTES.md with the notes of every version in backfill mode")
+
+	dryRun := flag.Bool("dryrun",
+		env.Bool("DRY_RUN", false), "Print the GitHub releases and files that would be created or edited without changing them")
+
+	releaseDraft := flag.Bool("releasedraft",
+		env.Bool("RELEASE_DRAFT", false), "Create the installer release as a draft, to be published with the promote mode")
+
+	releasePrerelease := flag.String("releaseprerelease",
+		env.String("RELEASE_PRERELEASE", "auto"), "true or false to force the pre-release state of the installer release, auto to set it for semver pre-release versions")
+
+	makeLatest := flag.String("makelatest",
+		env.String("MAKE_LATEST", ""), "true, false or legacy, whether the installer release becomes the latest one, defaults to true unless draft or pre-release")
+
+	pullRequest := flag.Bool("pullrequest",
+		env.Bool("PULL_REQUEST", false), "Open a pull request for RELEASE_NOTES.md instead of committing it to the default branch")
+
+	pullRequestBranch := flag.String("pullrequestbranch",
+		env.String("PULL_REQUEST_BRANCH", ""), "Branch of the RELEASE_NOTES.md pull request, defaults to release-notes/<version>")
+
+	pullRequestLabels := flag.String("pullrequestlabels",
+		env.String("PULL_REQUEST_LABELS", ""), "Comma separated list of labels of the RELEASE_NOTES.md pull request")
+
+	pullRequestReviewers := flag.String("pullrequestreviewers",
+		env.String("PULL_REQUEST_REVIEWERS", ""), "Comma separated list of reviewers (users or org/team) of the RELEASE_NOTES.md pull request")
+
+	strict := flag.Bool("strict",
+		env.Bool("STRICT", false), "Fail without publishing if any component is missing from the release notes")
+
 	// Parse flags
 	flag.Parse()
 
 	// Now dereference after parsing
 	log.Logger.Debug().Msgf("args %s", flag.Args())
 
+	organizations := strings.Split(*organization, ",")
+	log.Logger.Debug().Msgf("Parsed list of organizations: %s", organizations)
+
 	return Configuration{
+		Mode:                           *mode,
 		InstallerChartRegistry:         *installerChartRegistry,
 		InstallerChartRepository:       *installerChartRepository,
 		InstallerChartGithubRepository: *installerChartGithubRepository,
 		InstallerChartVersion:          *installerChartVersion,
+		InstallerChartPath:             *installerChartPath,
 		InstallerChartVersionPrevious:  *installerChartVersionPrevious,
-		Tokens:                         tokenList,
+		Tokens:                         parseTokens(*tokens, organizations),
+		GithubAppID:                    *githubAppID,
+		GithubAppPrivateKeyFile:        *githubAppPrivateKeyFile,
+		GithubAppPrivateKey:            *githubAppPrivateKey,
+		GithubMaxRetries:               *githubMaxRetries,
+		GithubMaxWait:                  *githubMaxWait,
 		InstallerOrganization:          *installerOrganization,
 		Organizations:                  organizations,
 		KrateoRepository:               *krateoRepository,
+		RegistryURL:                    *registryURL,
+		RegistryUsername:               *registryUsername,
+		RegistryToken:                  *registryToken,
+		RegistryCertFile:               *registryCertFile,
+		RegistryKeyFile:                *registryKeyFile,
+		RegistryCAFile:                 *registryCAFile,
+		RegistryInsecureSkipTLSVerify:  *registryInsecureSkipTLSVerify,
+		RegistryPlainHTTP:              *registryPlainHTTP,
+		RegistriesConfig:               *registriesConfig,
+		PullConcurrency:                *pullConcurrency,
+		PullTimeout:                    *pullTimeout,
+		KeepWorkspace:                  *keepWorkspace,
+		ChartCache:                     *chartCache,
+		ChartCacheDir:                  *chartCacheDir,
+		ChartCacheMaxSize:              *chartCacheMaxSize,
+		Offline:                        *offline,
+		ValuesSchema:                   *valuesSchema,
+		RepositoriesMapping:            *repositoriesMapping,
+		ShowUnchanged:                  *showUnchanged,
+		AllowDowngrade:                 *allowDowngrade,
+		Strict:                         *strict,
+		IncludePrereleases:             *includePrereleases,
+		BackfillDir:                    *backfillDir,
+		RebuildReleaseNotes:            *rebuildReleaseNotes,
+		DryRun:                         *dryRun,
+		ReleaseDraft:                   *releaseDraft,
+		ReleasePrerelease:              *releasePrerelease,
+		MakeLatest:                     *makeLatest,
+		PullRequest:                    *pullRequest,
+		PullRequestBranch:              *pullRequestBranch,
+		PullRequestLabels:              splitList(*pullRequestLabels),
+		PullRequestReviewers:           splitList(*pullRequestReviewers),
+	}
+}
+
+// splitList splits a comma separated list, dropping the empty items
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseTokens maps each organization to its token. A single token without organization is the default token (empty key),
+// several tokens without organization are assigned to the organizations in the same position, as in previous versions
+func parseTokens(list string, organizations []string) map[string]string {
+	tokens := map[string]string{}
+	unnamed := []string{}
+	for _, item := range splitList(list) {
+		if owner, token, ok := strings.Cut(item, "="); ok {
+			tokens[strings.TrimSpace(owner)] = strings.TrimSpace(token)
+			continue
+		}
+		unnamed = append(unnamed, item)
+	}
+
+	if len(unnamed) == 1 {
+		tokens[""] = unnamed[0]
+		return tokens
+	}
+	if len(unnamed) > 0 {
+		log.Logger.Warn().Msg("Tokens without organization are assigned by position in the list of organizations, use organization=token pairs instead")
+	}
+	for i, token := range unnamed {
+		if i >= len(organizations) {
+			log.Logger.Warn().Msgf("%d tokens for %d organizations, ignoring the extra tokens", len(unnamed), len(organizations))
+			break
+		}
+		if _, ok := tokens[organizations[i]]; !ok {
+			tokens[organizations[i]] = token
+		}
 	}
+	return tokens
 }
@@ -0,0 +1,155 @@
+package diff
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+
+	"installer-release-parser/apis"
+)
+
+type ChangeType string
+
+const (
+	Added      ChangeType = "Added"
+	Removed    ChangeType = "Removed"
+	Upgraded   ChangeType = "Upgraded"
+	Downgraded ChangeType = "Downgraded"
+	Moved      ChangeType = "Moved"
+	Unchanged  ChangeType = "Unchanged"
+)
+
+// Change is the difference of a component between two installer versions
+type Change struct {
+	Key  string     `json:"key"`
+	Type ChangeType `json:"type"`
+	// Component in the current version, its AppVersionPrevious is set when the versions are comparable. Empty if Removed
+	Current apis.Repoes `json:"current"`
+	// Component in the previous version, empty if Added
+	Previous apis.Repoes `json:"previous"`
+	Reason   string      `json:"reason"`
+}
+
+// ChangeSet groups the changes by type, each group is sorted by key
+type ChangeSet struct {
+	Added      []Change `json:"added"`
+	Removed    []Change `json:"removed"`
+	Upgraded   []Change `json:"upgraded"`
+	Downgraded []Change `json:"downgraded"`
+	Moved      []Change `json:"moved"`
+	Unchanged  []Change `json:"unchanged"`
+}
+
+// Compare computes the changes from the previous to the current components, both keyed by installer values key.
+// A component is Moved when its repository, chart registry or chart name changed, otherwise its appVersions are compared
+func Compare(current map[string]apis.Repoes, previous map[string]apis.Repoes) ChangeSet {
+	changes := ChangeSet{}
+
+	for _, key := range slices.Sorted(maps.Keys(previous)) {
+		if _, ok := current[key]; !ok {
+			changes.Removed = append(changes.Removed, Change{
+				Key:      key,
+				Type:     Removed,
+				Previous: previous[key],
+				Reason:   "not in the current version",
+			})
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(current)) {
+		currentChart := current[key]
+		previousChart, ok := previous[key]
+		if !ok {
+			changes.Added = append(changes.Added, Change{
+				Key:     key,
+				Type:    Added,
+				Current: currentChart,
+				Reason:  "not in the previous version",
+			})
+			continue
+		}
+
+		if reasons := movedReasons(currentChart, previousChart); len(reasons) > 0 {
+			changes.Moved = append(changes.Moved, Change{
+				Key:      key,
+				Type:     Moved,
+				Current:  currentChart,
+				Previous: previousChart,
+				Reason:   strings.Join(reasons, ", "),
+			})
+			continue
+		}
+
+		currentChart.AppVersionPrevious = previousChart.AppVersion
+		change := Change{
+			Key:      key,
+			Current:  currentChart,
+			Previous: previousChart,
+			Reason:   fmt.Sprintf("%s ... %s", previousChart.AppVersion, currentChart.AppVersion),
+		}
+
+		switch compareVersions(currentChart.AppVersion, previousChart.AppVersion) {
+		case 1:
+			change.Type = Upgraded
+			changes.Upgraded = append(changes.Upgraded, change)
+		case -1:
+			change.Type = Downgraded
+			changes.Downgraded = append(changes.Downgraded, change)
+		default:
+			change.Type = Unchanged
+			change.Reason = fmt.Sprintf("same version %s", currentChart.AppVersion)
+			changes.Unchanged = append(changes.Unchanged, change)
+		}
+	}
+
+	return changes
+}
+
+// All returns every change, grouped by type
+func (c ChangeSet) All() []Change {
+	return slices.Concat(c.Added, c.Removed, c.Moved, c.Upgraded, c.Downgraded, c.Unchanged)
+}
+
+// Range returns the current components to generate the release notes for, keyed by installer values key.
+// Added and Moved components have no previous version. Unchanged and Downgraded components are
+// excluded, since their notes would be empty or misleading
+func (c ChangeSet) Range() map[string]apis.Repoes {
+	result := map[string]apis.Repoes{}
+	for _, group := range [][]Change{c.Added, c.Moved, c.Upgraded} {
+		for _, change := range group {
+			result[change.Key] = change.Current
+		}
+	}
+	return result
+}
+
+func movedReasons(current apis.Repoes, previous apis.Repoes) []string {
+	reasons := []string{}
+	if current.ImageName != previous.ImageName {
+		reasons = append(reasons, fmt.Sprintf("repository %s -> %s", previous.ImageName, current.ImageName))
+	}
+	if current.Chart.Registry != previous.Chart.Registry {
+		reasons = append(reasons, fmt.Sprintf("chart registry %s -> %s", previous.Chart.Registry, current.Chart.Registry))
+	}
+	if current.Chart.Repository != previous.Chart.Repository {
+		reasons = append(reasons, fmt.Sprintf("chart %s -> %s", previous.Chart.Repository, current.Chart.Repository))
+	}
+	return reasons
+}
+
+// compareVersions compares two versions semantically. Versions that are not both semver have no order:
+// different ones (e.g., dev and 1.0.0, or two commit SHAs) are an upgrade, never a downgrade
+func compareVersions(a string, b string) int {
+	versionA, errA := semver.NewVersion(a)
+	versionB, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		if a == b {
+			return 0
+		}
+		return 1
+	}
+	return versionA.Compare(versionB)
+}
@@ -0,0 +1,281 @@
+package diff
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+
+	"installer-release-parser/apis"
+)
+
+func repo(imageName string, registry string, repository string, appVersion string) apis.Repoes {
+	return apis.Repoes{
+		ImageName: imageName,
+		Chart: apis.Chart{
+			Registry:   registry,
+			Repository: repository,
+			Version:    appVersion,
+			AppVersion: appVersion,
+		},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	const registry = "oci://ghcr.io/krateoplatformops"
+
+	tests := []struct {
+		name     string
+		current  map[string]apis.Repoes
+		previous map[string]apis.Repoes
+		// Expected type and reason of each change, by key
+		types   map[string]ChangeType
+		reasons map[string]string
+	}{
+		{
+			name:     "added",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			previous: map[string]apis.Repoes{},
+			types:    map[string]ChangeType{"core": Added},
+			reasons:  map[string]string{"core": "not in the previous version"},
+		},
+		{
+			name:     "removed",
+			current:  map[string]apis.Repoes{},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			types:    map[string]ChangeType{"core": Removed},
+			reasons:  map[string]string{"core": "not in the current version"},
+		},
+		{
+			name:     "moved image",
+			current:  map[string]apis.Repoes{"core": repo("core-provider", registry, "core", "1.1.0")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			types:    map[string]ChangeType{"core": Moved},
+			reasons:  map[string]string{"core": "repository core -> core-provider"},
+		},
+		{
+			name:     "moved registry",
+			current:  map[string]apis.Repoes{"core": repo("core", "https://charts.krateo.io", "core", "1.1.0")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			types:    map[string]ChangeType{"core": Moved},
+			reasons:  map[string]string{"core": "chart registry " + registry + " -> https://charts.krateo.io"},
+		},
+		{
+			name:     "moved chart name",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core-chart", "1.1.0")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			types:    map[string]ChangeType{"core": Moved},
+			reasons:  map[string]string{"core": "chart core -> core-chart"},
+		},
+		{
+			name:     "moved image and registry",
+			current:  map[string]apis.Repoes{"core": repo("core-provider", "https://charts.krateo.io", "core", "1.0.0")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			types:    map[string]ChangeType{"core": Moved},
+			reasons:  map[string]string{"core": "repository core -> core-provider, chart registry " + registry + " -> https://charts.krateo.io"},
+		},
+		{
+			name:     "upgraded",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "1.10.0")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.9.0")},
+			types:    map[string]ChangeType{"core": Upgraded},
+			reasons:  map[string]string{"core": "1.9.0 ... 1.10.0"},
+		},
+		{
+			name:     "downgraded",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.1")},
+			types:    map[string]ChangeType{"core": Downgraded},
+			reasons:  map[string]string{"core": "1.0.1 ... 1.0.0"},
+		},
+		{
+			name:     "unchanged",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			types:    map[string]ChangeType{"core": Unchanged},
+			reasons:  map[string]string{"core": "same version 1.0.0"},
+		},
+		{
+			name:     "unchanged with v prefix",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "v1.0.0")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			types:    map[string]ChangeType{"core": Unchanged},
+			reasons:  map[string]string{"core": "same version v1.0.0"},
+		},
+		{
+			name:     "non-semver upgraded",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "main")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "latest")},
+			types:    map[string]ChangeType{"core": Upgraded},
+			reasons:  map[string]string{"core": "latest ... main"},
+		},
+		{
+			name:     "non-semver to semver upgraded",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "dev")},
+			types:    map[string]ChangeType{"core": Upgraded},
+			reasons:  map[string]string{"core": "dev ... 1.0.0"},
+		},
+		{
+			name:     "semver to non-semver upgraded",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "dev")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "1.0.0")},
+			types:    map[string]ChangeType{"core": Upgraded},
+			reasons:  map[string]string{"core": "1.0.0 ... dev"},
+		},
+		{
+			name:     "commit SHAs upgraded",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "3f2a9c1")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "e81b7d4")},
+			types:    map[string]ChangeType{"core": Upgraded},
+			reasons:  map[string]string{"core": "e81b7d4 ... 3f2a9c1"},
+		},
+		{
+			name:     "non-semver unchanged",
+			current:  map[string]apis.Repoes{"core": repo("core", registry, "core", "latest")},
+			previous: map[string]apis.Repoes{"core": repo("core", registry, "core", "latest")},
+			types:    map[string]ChangeType{"core": Unchanged},
+			reasons:  map[string]string{"core": "same version latest"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := Compare(test.current, test.previous)
+
+			all := changes.All()
+			if len(all) != len(test.types) {
+				t.Fatalf("got %d changes, want %d: %+v", len(all), len(test.types), all)
+			}
+			for _, change := range all {
+				if change.Type != test.types[change.Key] {
+					t.Errorf("%s: got type %s, want %s", change.Key, change.Type, test.types[change.Key])
+				}
+				if change.Reason != test.reasons[change.Key] {
+					t.Errorf("%s: got reason %q, want %q", change.Key, change.Reason, test.reasons[change.Key])
+				}
+			}
+		})
+	}
+}
+
+func TestCompareAppVersionPrevious(t *testing.T) {
+	const registry = "oci://ghcr.io/krateoplatformops"
+
+	current := map[string]apis.Repoes{
+		"added":      repo("added", registry, "added", "1.0.0"),
+		"moved":      repo("moved-provider", registry, "moved", "2.0.0"),
+		"upgraded":   repo("upgraded", registry, "upgraded", "1.1.0"),
+		"downgraded": repo("downgraded", registry, "downgraded", "1.0.0"),
+	}
+	previous := map[string]apis.Repoes{
+		"moved":      repo("moved", registry, "moved", "1.0.0"),
+		"upgraded":   repo("upgraded", registry, "upgraded", "1.0.0"),
+		"downgraded": repo("downgraded", registry, "downgraded", "1.1.0"),
+	}
+
+	want := map[string]string{
+		"added":      "",
+		"moved":      "",
+		"upgraded":   "1.0.0",
+		"downgraded": "1.1.0",
+	}
+	for _, change := range Compare(current, previous).All() {
+		if change.Current.AppVersionPrevious != want[change.Key] {
+			t.Errorf("%s: got AppVersionPrevious %q, want %q", change.Key, change.Current.AppVersionPrevious, want[change.Key])
+		}
+	}
+}
+
+func TestCompareOrdering(t *testing.T) {
+	const registry = "oci://ghcr.io/krateoplatformops"
+
+	current := map[string]apis.Repoes{}
+	previous := map[string]apis.Repoes{}
+	for _, key := range []string{"opa", "core", "smtp", "authn", "frontend", "eventrouter", "finops", "crate"} {
+		current[key+"-new"] = repo(key, registry, key, "1.0.0")
+		current[key] = repo(key, registry, key, "1.1.0")
+		previous[key] = repo(key, registry, key, "1.0.0")
+		previous[key+"-old"] = repo(key, registry, key, "1.0.0")
+	}
+
+	first := Compare(current, previous)
+	for _, group := range [][]Change{first.Added, first.Removed, first.Upgraded} {
+		keys := []string{}
+		for _, change := range group {
+			keys = append(keys, change.Key)
+		}
+		if !slices.IsSorted(keys) {
+			t.Errorf("changes not sorted by key: %v", keys)
+		}
+	}
+
+	for range 20 {
+		if changes := Compare(current, previous); !reflect.DeepEqual(changes, first) {
+			t.Fatalf("changes differ between runs:\n%+v\n%+v", first, changes)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	const registry = "oci://ghcr.io/krateoplatformops"
+
+	tests := []struct {
+		name     string
+		current  map[string]apis.Repoes
+		previous map[string]apis.Repoes
+		want     []string
+	}{
+		{
+			name:     "empty",
+			current:  map[string]apis.Repoes{},
+			previous: map[string]apis.Repoes{},
+			want:     []string{},
+		},
+		{
+			name: "added moved and upgraded only",
+			current: map[string]apis.Repoes{
+				"added":      repo("added", registry, "added", "1.0.0"),
+				"moved":      repo("moved-provider", registry, "moved", "1.0.0"),
+				"upgraded":   repo("upgraded", registry, "upgraded", "1.1.0"),
+				"downgraded": repo("downgraded", registry, "downgraded", "1.0.0"),
+				"unchanged":  repo("unchanged", registry, "unchanged", "1.0.0"),
+			},
+			previous: map[string]apis.Repoes{
+				"removed":    repo("removed", registry, "removed", "1.0.0"),
+				"moved":      repo("moved", registry, "moved", "1.0.0"),
+				"upgraded":   repo("upgraded", registry, "upgraded", "1.0.0"),
+				"downgraded": repo("downgraded", registry, "downgraded", "1.1.0"),
+				"unchanged":  repo("unchanged", registry, "unchanged", "1.0.0"),
+			},
+			want: []string{"added", "moved", "upgraded"},
+		},
+		{
+			name: "non-semver upgraded",
+			current: map[string]apis.Repoes{
+				"core": repo("core", registry, "core", "main"),
+			},
+			previous: map[string]apis.Repoes{
+				"core": repo("core", registry, "core", "latest"),
+			},
+			want: []string{"core"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := Compare(test.current, test.previous)
+			result := changes.Range()
+
+			keys := slices.Sorted(maps.Keys(result))
+			if !slices.Equal(keys, test.want) {
+				t.Fatalf("got %v, want %v", keys, test.want)
+			}
+			for key, chart := range result {
+				if chart.ImageName != test.current[key].ImageName || chart.AppVersion != test.current[key].AppVersion {
+					t.Errorf("%s: got %+v, want the current chart %+v", key, chart, test.current[key])
+				}
+			}
+		})
+	}
+}
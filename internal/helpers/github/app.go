@@ -0,0 +1,157 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/rs/zerolog/log"
+)
+
+// App authenticates as a GitHub App to mint the installation tokens of the organizations
+type App struct {
+	ID         int64
+	PrivateKey *rsa.PrivateKey
+	client     *github.Client
+	// Transport of the requests, after authentication
+	transport http.RoundTripper
+}
+
+// NewApp loads the private key of the app from keyFile, or from key (PEM content) if keyFile is empty.
+// Requests are sent through transport, http.DefaultTransport if nil
+func NewApp(id int64, keyFile string, key string, transport http.RoundTripper) (*App, error) {
+	keyData := []byte(key)
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		keyData = data
+	}
+
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode private key: no PEM block found")
+	}
+	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, errr := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if errr != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse private key: not an RSA key")
+		}
+		privateKey = rsaKey
+	}
+
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	app := &App{ID: id, PrivateKey: privateKey, transport: transport}
+	app.client = github.NewClient(&http.Client{Transport: &appTransport{app: app}})
+	return app, nil
+}
+
+// jwt returns a token authenticating as the app, valid for 10 minutes
+func (a *App) jwt() (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	// Backdated to allow for clock drift
+	payload, _ := json.Marshal(map[string]int64{
+		"iat": now.Add(-60 * time.Second).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": a.ID,
+	})
+
+	data := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(data))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.PrivateKey, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	return data + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Client returns a client authenticated as the installation of the app in the organization
+func (a *App) Client(owner string) (*github.Client, error) {
+	installation, _, err := a.client.Apps.FindOrganizationInstallation(requestContext(), owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the installation of app %d in %s: %w", a.ID, owner, err)
+	}
+	log.Debug().Msgf("Using installation %d of app %d for %s", installation.GetID(), a.ID, owner)
+
+	return github.NewClient(&http.Client{Transport: &installationTransport{
+		app:            a,
+		installationID: installation.GetID(),
+	}}), nil
+}
+
+// appTransport authenticates the requests with the JWT of the app
+type appTransport struct {
+	app *App
+}
+
+func (t *appTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	token, err := t.app.jwt()
+	if err != nil {
+		return nil, err
+	}
+	request = request.Clone(request.Context())
+	request.Header.Set("Authorization", "Bearer "+token)
+	return t.app.transport.RoundTrip(request)
+}
+
+// installationTransport authenticates the requests with the installation token, minting a new one before it expires
+type installationTransport struct {
+	app            *App
+	installationID int64
+
+	mutex     sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func (t *installationTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	token, err := t.installationToken(request.Context())
+	if err != nil {
+		return nil, err
+	}
+	request = request.Clone(request.Context())
+	request.Header.Set("Authorization", "token "+token)
+	return t.app.transport.RoundTrip(request)
+}
+
+func (t *installationTransport) installationToken(ctx context.Context) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	// Installation tokens last one hour, they are refreshed a few minutes earlier
+	if t.token != "" && time.Until(t.expiresAt) > 5*time.Minute {
+		return t.token, nil
+	}
+
+	token, _, err := t.app.client.Apps.CreateInstallationToken(ctx, t.installationID, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token for installation %d: %w", t.installationID, err)
+	}
+	log.Debug().Msgf("Created token for installation %d, expiring at %s", t.installationID, token.GetExpiresAt())
+
+	t.token = token.GetToken()
+	t.expiresAt = token.GetExpiresAt().Time
+	return t.token, nil
+}
@@ -0,0 +1,85 @@
+package github
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/rs/zerolog/log"
+)
+
+// ClientPool holds the GitHub client of each organization.
+// Organizations without token use the default client, authenticated with the default token if any, otherwise anonymous
+type ClientPool struct {
+	defaultClient *github.Client
+	clients       map[string]*github.Client
+	// GitHub App of the organizations without token, if any
+	app *App
+}
+
+// NewClientPool creates a client for each organization=token pair, the token with an empty organization is the default one.
+// Requests are sent through transport, http.DefaultTransport if nil
+func NewClientPool(tokens map[string]string, transport http.RoundTripper) *ClientPool {
+	client := github.NewClient(&http.Client{Transport: transport})
+
+	pool := &ClientPool{
+		defaultClient: client,
+		clients:       map[string]*github.Client{},
+	}
+	for owner, token := range tokens {
+		if token == "" {
+			continue
+		}
+		if owner == "" {
+			pool.defaultClient = client.WithAuthToken(token)
+			continue
+		}
+		pool.clients[owner] = client.WithAuthToken(token)
+	}
+	return pool
+}
+
+// For returns the client of the organization, never nil.
+// With a GitHub App, the installation of organizations not seen yet is looked up once
+func (p *ClientPool) For(owner string) *github.Client {
+	if client, ok := p.clients[owner]; ok {
+		return client
+	}
+	if p.app != nil && owner != "" {
+		client, err := p.app.Client(owner)
+		if err != nil {
+			log.Warn().Err(err).Msgf("%s: app not installed, using the default client", owner)
+			client = p.defaultClient
+		}
+		p.clients[owner] = client
+		return client
+	}
+	return p.defaultClient
+}
+
+// UseApp authenticates the organizations without token as the installations of the app.
+// The installations of the required organizations are looked up immediately, failing if the app is not installed there.
+// Other organizations where the app is not installed use the default client
+func (p *ClientPool) UseApp(app *App, required ...string) error {
+	p.app = app
+	for _, owner := range required {
+		if _, ok := p.clients[owner]; ok {
+			continue
+		}
+		client, err := app.Client(owner)
+		if err != nil {
+			return err
+		}
+		p.clients[owner] = client
+	}
+	return nil
+}
+
+// responseBody returns the body of an error response, empty if the request failed before getting a response
+func responseBody(response *github.Response) string {
+	if response == nil || response.Body == nil {
+		return ""
+	}
+	bodyData, _ := io.ReadAll(response.Body)
+	return string(bodyData)
+}
@@ -0,0 +1,32 @@
+package github
+
+import "fmt"
+
+// ComponentError is the failure to generate the release notes of a component in every organization
+type ComponentError struct {
+	Key        string
+	Repository string
+	Err        error
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("%s (%s): %s", e.Key, e.Repository, e.Err)
+}
+
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
+
+// PublishError is the failure of a change on GitHub, Step describes the change (e.g., create release)
+type PublishError struct {
+	Step string
+	Err  error
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("could not %s: %s", e.Step, e.Err)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
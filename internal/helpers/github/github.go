@@ -1,158 +1,261 @@
 package github
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"installer-release-parser/apis"
 	"installer-release-parser/internal/helpers/configuration"
-	"installer-release-parser/internal/helpers/helm"
-	"io"
+	"installer-release-parser/internal/helpers/markdown"
+	"installer-release-parser/internal/helpers/repositories"
+	"maps"
+	"slices"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/google/go-github/v72/github"
 	"github.com/rs/zerolog/log"
 )
 
-// This function assumes that all repositories listed in the installer exist and are tagged with the installer versions
-func GetReleaseNotes(charts map[string]apis.Repoes, tokens []string, owners []string) string {
-	client := github.NewClient(nil)
+// This function assumes that all repositories listed in the installer exist and are tagged with the installer versions.
+// Charts without previous version get the notes of their whole history up to the tag.
+// The organization of each repository is the mapped one, or the one found by the resolver.
+// It returns the release notes, the full name (owner/repository) of the repository that provided them by chart key
+// and the charts whose release notes could not be generated
+func GetReleaseNotes(charts map[string]apis.Repoes, clients *ClientPool, resolver *Resolver, mapping repositories.Mapping) (string, map[string]string, []*ComponentError) {
+	finalReleaseNotes := ""
+	fullNames := map[string]string{}
+	failures := []*ComponentError{}
 
-	clients := map[string]*github.Client{}
-	if len(tokens) != 0 {
-		for i, token := range tokens {
-			clients[owners[i]] = client.WithAuthToken(token)
+	for _, key := range slices.Sorted(maps.Keys(charts)) {
+		chart := charts[key]
+		releaseNotes, fullName, err := chartReleaseNotes(chart, clients, resolver, mapping)
+		if err != nil {
+			failures = append(failures, &ComponentError{Key: key, Repository: chart.ImageName, Err: err})
+			continue
 		}
+		finalReleaseNotes += releaseNotes
+		fullNames[key] = fullName
 	}
 
-	finalReleaseNotes := ""
+	return finalReleaseNotes, fullNames, failures
+}
 
-	for _, chart := range charts {
-		if chart.AppVersionPrevious == "" {
-			log.Warn().Msg("empty previous version, using automatic option")
+// chartReleaseNotes generates the release notes of the chart from the repository of its image.
+// If that fails, they are generated from the mapped repository of the image, if any, with the chart version.
+// It returns the release notes and the full name of the repository that provided them
+func chartReleaseNotes(chart apis.Repoes, clients *ClientPool, resolver *Resolver, mapping repositories.Mapping) (string, string, error) {
+	owner := chart.Organization
+	var err error
+	if owner == "" {
+		owner, err = resolver.Resolve(chart.ImageName, chart.Sources)
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msgf("%s: could not find the repository", chart.ImageName)
+	} else {
+		ownerClient := clients.For(owner)
+		previousTag := chart.AppVersionPrevious
+		if previousTag == "" {
+			log.Info().Msgf("%s: empty previous version, using the whole history", chart.ImageName)
+			previousTag = firstTag(ownerClient, owner, chart.ImageName, chart.AppVersion)
 		}
-		for _, owner := range owners {
-			log.Info().Msgf("Generating release notes for %s with tag range %s ... %s", chart.ImageName, chart.AppVersionPrevious, chart.AppVersion)
-			release, response, err := clients[owner].Repositories.GenerateReleaseNotes(context.Background(), owner, chart.ImageName, &github.GenerateNotesOptions{
-				TagName:         chart.AppVersion,
-				PreviousTagName: &chart.AppVersionPrevious,
-			})
-			if err != nil {
-				log.Warn().Err(err).Msgf("%s: there was an error generating the release", chart.ImageName)
-				bodyData, _ := io.ReadAll(response.Body)
-				log.Warn().Msgf("Body %s", string(bodyData))
-				log.Warn().Msg("Container probably missing, trying hardcoded values with chart version...")
-				if value, ok := helm.HARDCODED_REPOSITORIES[chart.ImageName]; ok {
-					log.Info().Msgf("Generating release notes for %s with tag range %s ... %s", value, chart.AppVersionPrevious, chart.AppVersion)
-					release, response, errr := clients[owner].Repositories.GenerateReleaseNotes(context.Background(), owner, value, &github.GenerateNotesOptions{
-						TagName: chart.Version,
-					})
-					if errr != nil {
-						log.Warn().Err(err).Msgf("%s: there was an error generating the release for the chart", value)
-						bodyData, _ := io.ReadAll(response.Body)
-						log.Warn().Msgf("Body %s", string(bodyData))
-					} else {
-						finalReleaseNotes += fmt.Sprintf("## %s v%s\n### What's Changed\n%s\n\n", value, chart.Version, formatReleaseNotes(release.Body))
-						break
-					}
-				}
-			} else {
-				finalReleaseNotes += fmt.Sprintf("## %s v%s\n### What's Changed\n%s\n\n", chart.ImageName, chart.AppVersion, formatReleaseNotes(release.Body))
-				break
-			}
+		notesOptions := &github.GenerateNotesOptions{
+			TagName: chart.AppVersion,
+		}
+		if previousTag != "" {
+			notesOptions.PreviousTagName = &previousTag
+		}
+
+		log.Info().Msgf("Generating release notes for %s/%s with tag range %s ... %s", owner, chart.ImageName, previousTag, chart.AppVersion)
+		release, response, errr := ownerClient.Repositories.GenerateReleaseNotes(requestContext(), owner, chart.ImageName, notesOptions)
+		if errr == nil {
+			return fmt.Sprintf("## %s v%s\n### What's Changed\n%s\n\n", chart.ImageName, chart.AppVersion, formatReleaseNotes(release.Body)), owner + "/" + chart.ImageName, nil
 		}
+		err = errr
+		log.Warn().Err(err).Msgf("%s: there was an error generating the release", chart.ImageName)
+		log.Warn().Msgf("Body %s", responseBody(response))
 	}
 
-	return finalReleaseNotes
+	mapped, ok := mapping.Lookup(chart.ImageName)
+	if !ok {
+		return "", "", err
+	}
+	log.Warn().Msg("Container probably missing, trying mapped repositories with chart version...")
+
+	value := mapped.Name
+	mappedOwner := mapped.Organization
+	if mappedOwner == "" {
+		mappedOwner = chart.Organization
+	}
+	if mappedOwner == "" {
+		mappedOwner, err = resolver.Resolve(value, chart.Sources)
+		if err != nil {
+			log.Warn().Err(err).Msgf("%s: could not find the repository", value)
+			return "", "", err
+		}
+	}
+
+	log.Info().Msgf("Generating release notes for %s/%s with tag range %s ... %s", mappedOwner, value, chart.AppVersionPrevious, chart.AppVersion)
+	release, response, err := clients.For(mappedOwner).Repositories.GenerateReleaseNotes(requestContext(), mappedOwner, value, &github.GenerateNotesOptions{
+		TagName: chart.Version,
+	})
+	if err != nil {
+		log.Warn().Err(err).Msgf("%s: there was an error generating the release for the chart", value)
+		log.Warn().Msgf("Body %s", responseBody(response))
+		return "", "", err
+	}
+	return fmt.Sprintf("## %s v%s\n### What's Changed\n%s\n\n", value, chart.Version, formatReleaseNotes(release.Body)), mappedOwner + "/" + value, nil
 }
 
-func CreateInstallerRelease(releaseNotes string, config configuration.Configuration) {
-	client := github.NewClient(nil)
+// firstTag returns the oldest semver tag of the repository preceding tag, so that the notes cover the whole history.
+// It returns an empty string if there is none, letting GitHub choose the previous tag
+func firstTag(client *github.Client, owner string, repository string, tag string) string {
+	current, err := semver.NewVersion(tag)
+	if err != nil {
+		return ""
+	}
 
-	clients := map[string]*github.Client{}
-	if len(config.Tokens) != 0 {
-		for i, token := range config.Tokens {
-			clients[config.Organizations[i]] = client.WithAuthToken(token)
+	var first *semver.Version
+	firstName := ""
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		tags, response, err := client.Repositories.ListTags(requestContext(), owner, repository, opts)
+		if err != nil {
+			log.Debug().Err(err).Msgf("%s/%s: could not list tags", owner, repository)
+			return ""
 		}
+		for _, t := range tags {
+			version, err := semver.NewVersion(t.GetName())
+			if err != nil || !version.LessThan(current) {
+				continue
+			}
+			if first == nil || version.LessThan(first) {
+				first = version
+				firstName = t.GetName()
+			}
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
 	}
+	return firstName
+}
+
+// CreateInstallerRelease creates or edits the installer release and sets the section of the version in RELEASE_NOTES.md.
+// In dry run, the release and the file are only read and the changes are printed to stdout.
+// A failure on the release does not prevent the update of the file, the returned error joins the PublishError of both.
+// It returns the URL of the pull request of RELEASE_NOTES.md, if any
+func CreateInstallerRelease(clients *ClientPool, releaseNotes string, config configuration.Configuration) (string, error) {
+	client := clients.For(config.InstallerOrganization)
 
-	release, _, err := clients[config.InstallerOrganization].Repositories.GetReleaseByTag(context.Background(), config.InstallerOrganization, config.InstallerChartGithubRepository, config.InstallerChartVersion)
+	errs := []error{}
+
+	title := fmt.Sprintf("Release Notes For Krateo %s ... %s\n", config.InstallerChartVersionPrevious, config.InstallerChartVersion)
+	settings := releaseSettings(config)
+	release, err := findRelease(client, config.InstallerOrganization, config.InstallerChartGithubRepository, config.InstallerChartVersion)
 	if err != nil {
+		errs = append(errs, &PublishError{Step: "get the release for tag " + config.InstallerChartVersion, Err: err})
+	} else if release == nil {
 		log.Info().Msgf("Release not found for tag %s", config.InstallerChartVersion)
-		_, response, errr := clients[config.InstallerOrganization].Repositories.CreateRelease(context.Background(), config.InstallerOrganization, config.InstallerChartGithubRepository, &github.RepositoryRelease{
-			TagName:    &config.InstallerChartVersion,
-			Name:       stringPointer(fmt.Sprintf("Release Notes For Krateo %s ... %s\n", config.InstallerChartVersionPrevious, config.InstallerChartVersion)),
-			Body:       &releaseNotes,
-			MakeLatest: stringPointer("true"),
-		})
-		if errr != nil {
-			log.Error().Err(err).Msgf("could not create release")
-			bodyData, _ := io.ReadAll(response.Body)
-			log.Error().Msgf("Body %s", string(bodyData))
+		if config.DryRun {
+			printPlan("create release on %s/%s: tag %s, title %q, %s", config.InstallerOrganization, config.InstallerChartGithubRepository, config.InstallerChartVersion, title, settings)
 		} else {
-			log.Info().Msgf("Release created for tag %s", config.InstallerChartVersion)
+			_, response, errr := client.Repositories.CreateRelease(requestContext(), config.InstallerOrganization, config.InstallerChartGithubRepository, &github.RepositoryRelease{
+				TagName:    &config.InstallerChartVersion,
+				Name:       stringPointer(title),
+				Body:       &releaseNotes,
+				Draft:      &settings.Draft,
+				Prerelease: &settings.Prerelease,
+				MakeLatest: stringPointer(settings.MakeLatest),
+			})
+			if errr != nil {
+				log.Debug().Msgf("Body %s", responseBody(response))
+				errs = append(errs, &PublishError{Step: "create release", Err: errr})
+			} else {
+				log.Info().Msgf("Release created for tag %s (%s)", config.InstallerChartVersion, settings)
+			}
 		}
+	} else if config.DryRun {
+		printPlan("edit release %d on %s/%s: tag %s, title %q, replacing its body", release.GetID(), config.InstallerOrganization, config.InstallerChartGithubRepository, release.GetTagName(), release.GetName())
+		fmt.Print(fileDiff("release body", release.GetBody(), releaseNotes))
 	} else {
 		release.Body = &releaseNotes
-		_, response, errr := clients[config.InstallerOrganization].Repositories.EditRelease(context.Background(), config.InstallerOrganization, config.InstallerChartGithubRepository, *release.ID, release)
+		_, response, errr := client.Repositories.EditRelease(requestContext(), config.InstallerOrganization, config.InstallerChartGithubRepository, *release.ID, release)
 		if errr != nil {
-			log.Error().Err(err).Msgf("could not edit release")
-			bodyData, _ := io.ReadAll(response.Body)
-			log.Error().Msgf("Body %s", string(bodyData))
+			log.Debug().Msgf("Body %s", responseBody(response))
+			errs = append(errs, &PublishError{Step: "edit release", Err: errr})
 		} else {
 			log.Info().Msgf("Release edited for tag %s", config.InstallerChartVersion)
 		}
 	}
 
 	// --- Append release notes to RELEASE_NOTES.md in config.KrateoRepository ---
-	ctx := context.Background()
+	branch := releaseNotesBranch(config, config.InstallerChartVersion)
+	file, err := readReleaseNotes(client, config, branch)
+	if err != nil {
+		return "", errors.Join(append(errs, &PublishError{Step: "read RELEASE_NOTES.md", Err: err})...)
+	}
 
-	// Get the current contents of RELEASE_NOTES.md
-	fileContent, _, resp, err := clients[config.InstallerOrganization].Repositories.GetContents(
-		ctx,
-		config.InstallerOrganization,
-		config.KrateoRepository,
-		"RELEASE_NOTES.md",
-		nil,
-	)
+	// Replace the section of the version if it already exists, so that re-runs do not duplicate it
+	notesFile := markdown.ParseReleaseNotesFile(file.content)
+	if !notesFile.Set(config.InstallerChartVersion, releaseNotes) {
+		log.Info().Msgf("RELEASE_NOTES.md is up to date for version %s, skipping the commit", config.InstallerChartVersion)
+		return file.pullRequest.GetHTMLURL(), errors.Join(errs...)
+	}
+	newContent := notesFile.String()
 
-	var newContent string
-	var sha *string
+	message := fmt.Sprintf("chore: update release notes for %s", config.InstallerChartVersion)
+	if config.DryRun {
+		printCommitPlan(config, file, branch, message, newContent)
+		return "", errors.Join(errs...)
+	}
 
+	pullRequest, err := commitReleaseNotes(client, config, file, newContent, message, branch, fmt.Sprintf("Release notes for Krateo %s", config.InstallerChartVersion))
 	if err != nil {
-		// If file not found, start a new one
-		if resp != nil && resp.StatusCode == 404 {
-			log.Info().Msg("RELEASE_NOTES.md not found, creating a new one")
-			newContent = fmt.Sprintf("# Release %s\n\n%s\n\n", config.InstallerChartVersion, releaseNotes)
-		} else {
-			log.Error().Err(err).Msg("could not retrieve RELEASE_NOTES.md")
-			return
-		}
-	} else {
-		// Append to existing contents
-		content, err := fileContent.GetContent()
-		if err != nil {
-			log.Error().Err(err).Msg("could not decode RELEASE_NOTES.md")
-			return
+		return "", errors.Join(append(errs, &PublishError{Step: "update RELEASE_NOTES.md", Err: err})...)
+	}
+	log.Info().Msgf("RELEASE_NOTES.md updated for version %s", config.InstallerChartVersion)
+	return pullRequest, errors.Join(errs...)
+}
+
+// RebuildReleaseNotes sets the given sections in RELEASE_NOTES.md in config.KrateoRepository, in a single commit.
+// The sections of the other versions and the text preceding them are kept as they are.
+// In dry run, the changes are only printed to stdout. It returns the URL of the pull request, if any
+func RebuildReleaseNotes(clients *ClientPool, sections []markdown.ReleaseSection, config configuration.Configuration) (string, error) {
+	if len(sections) == 0 {
+		return "", &PublishError{Step: "rebuild RELEASE_NOTES.md", Err: fmt.Errorf("no release notes to set")}
+	}
+	client := clients.For(config.InstallerOrganization)
+
+	branch := releaseNotesBranch(config, "rebuild")
+	file, err := readReleaseNotes(client, config, branch)
+	if err != nil {
+		return "", &PublishError{Step: "read RELEASE_NOTES.md", Err: err}
+	}
+
+	notesFile := markdown.ParseReleaseNotesFile(file.content)
+	changed := false
+	for _, section := range sections {
+		if notesFile.Set(section.Version, section.Notes) {
+			changed = true
 		}
-		newContent = fmt.Sprintf("# Release %s\n\n%s\n<br><br>\n%s", config.InstallerChartVersion, releaseNotes, content)
-		sha = fileContent.SHA
 	}
+	if !changed {
+		log.Info().Msg("RELEASE_NOTES.md is up to date, skipping the commit")
+		return file.pullRequest.GetHTMLURL(), nil
+	}
+	content := notesFile.String()
 
-	opts := &github.RepositoryContentFileOptions{
-		Message: github.Ptr(fmt.Sprintf("chore: update release notes for %s", config.InstallerChartVersion)),
-		Content: []byte(newContent),
-		SHA:     sha,
+	message := "chore: rebuild release notes"
+	if config.DryRun {
+		printCommitPlan(config, file, branch, message, content)
+		return "", nil
 	}
 
-	_, _, err = clients[config.InstallerOrganization].Repositories.UpdateFile(
-		ctx,
-		config.InstallerOrganization,
-		config.KrateoRepository,
-		"RELEASE_NOTES.md",
-		opts,
-	)
+	pullRequest, err := commitReleaseNotes(client, config, file, content, message, branch, "Rebuild the release notes of Krateo")
 	if err != nil {
-		log.Error().Err(err).Msg("could not update RELEASE_NOTES.md")
-	} else {
-		log.Info().Msgf("RELEASE_NOTES.md updated for version %s", config.InstallerChartVersion)
+		return "", &PublishError{Step: "rebuild RELEASE_NOTES.md", Err: err}
 	}
+	log.Info().Msg("RELEASE_NOTES.md rebuilt")
+	return pullRequest, nil
 }
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"installer-release-parser/internal/helpers/configuration"
 )
 
 func formatReleaseNotes(input string) string {
@@ -73,3 +77,41 @@ func formatReleaseNotes(input string) string {
 func stringPointer(value string) *string {
 	return &value
 }
+
+// printPlan prints a change that is not performed because of the dry run
+func printPlan(format string, args ...any) {
+	fmt.Printf("[dry-run] would "+format+"\n", args...)
+}
+
+// printCommitPlan prints the commit of RELEASE_NOTES.md, or the pull request, and the diff of the file
+func printCommitPlan(config configuration.Configuration, file releaseNotesFile, branch string, message string, current string) {
+	switch {
+	case !config.PullRequest:
+		printPlan("commit RELEASE_NOTES.md on %s/%s: %q", config.InstallerOrganization, config.KrateoRepository, message)
+	case file.pullRequest != nil:
+		printPlan("commit RELEASE_NOTES.md on top of branch %s of %s/%s and update pull request #%d: %q", branch, config.InstallerOrganization, config.KrateoRepository, file.pullRequest.GetNumber(), message)
+	case file.branchExists:
+		printPlan("reset branch %s of %s/%s to the default branch, commit RELEASE_NOTES.md on it and open a pull request: %q", branch, config.InstallerOrganization, config.KrateoRepository, message)
+	default:
+		printPlan("create branch %s of %s/%s, commit RELEASE_NOTES.md on it and open a pull request: %q", branch, config.InstallerOrganization, config.KrateoRepository, message)
+	}
+	fmt.Print(fileDiff("RELEASE_NOTES.md", file.content, current))
+}
+
+// fileDiff returns the unified diff between the previous and the current content of a file, or a note if they are equal
+func fileDiff(name string, previous string, current string) string {
+	if previous == current {
+		return fmt.Sprintf("%s: no changes\n", name)
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(previous),
+		B:        difflib.SplitLines(current),
+		FromFile: "a/" + name,
+		ToFile:   "b/" + name,
+		Context:  3,
+	})
+	if err != nil {
+		return fmt.Sprintf("%s: could not compute the diff: %s\n", name, err)
+	}
+	return diff
+}
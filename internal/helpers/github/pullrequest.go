@@ -0,0 +1,191 @@
+package github
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/rs/zerolog/log"
+
+	"installer-release-parser/internal/helpers/configuration"
+)
+
+// releaseNotesBranch returns the branch of the pull request, config.PullRequestBranch or release-notes/<name>
+func releaseNotesBranch(config configuration.Configuration, name string) string {
+	if config.PullRequestBranch != "" {
+		return config.PullRequestBranch
+	}
+	return "release-notes/" + name
+}
+
+// releaseNotesFile is RELEASE_NOTES.md as read from the branch the next commit goes to
+type releaseNotesFile struct {
+	content string
+	// SHA of the file, nil if it does not exist
+	sha *string
+	// Whether the pull request branch already exists
+	branchExists bool
+	// Open pull request of the branch, if any. The file is then read from the branch
+	pullRequest *github.PullRequest
+}
+
+// readReleaseNotes reads RELEASE_NOTES.md in config.KrateoRepository, empty if it does not exist. When config.PullRequest
+// is set and the branch has an open pull request, the file is read from the branch, so that the changes pushed to it are kept.
+// A branch without open pull request (e.g., left by a merged one) is stale: the file is read from the default branch
+func readReleaseNotes(client *github.Client, config configuration.Configuration, branch string) (releaseNotesFile, error) {
+	ctx := requestContext()
+	owner := config.InstallerOrganization
+	repo := config.KrateoRepository
+
+	file := releaseNotesFile{}
+	options := &github.RepositoryContentGetOptions{}
+	if config.PullRequest {
+		_, response, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+branch)
+		if err == nil {
+			file.branchExists = true
+		} else if response == nil || response.StatusCode != 404 {
+			return file, fmt.Errorf("failed to get branch %s: %w", branch, err)
+		}
+	}
+	if file.branchExists {
+		pulls, _, err := client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+			State: "open",
+			Head:  owner + ":" + branch,
+		})
+		if err != nil {
+			return file, fmt.Errorf("failed to list pull requests: %w", err)
+		}
+		if len(pulls) > 0 {
+			file.pullRequest = pulls[0]
+			options.Ref = branch
+		} else {
+			log.Info().Msgf("Branch %s has no open pull request, it will be reset to the default branch", branch)
+		}
+	}
+
+	fileContent, _, response, err := client.Repositories.GetContents(ctx, owner, repo, "RELEASE_NOTES.md", options)
+	if err != nil {
+		if response != nil && response.StatusCode == 404 {
+			log.Info().Msg("RELEASE_NOTES.md not found, creating a new one")
+			return file, nil
+		}
+		return file, fmt.Errorf("failed to retrieve RELEASE_NOTES.md: %w", err)
+	}
+	file.content, err = fileContent.GetContent()
+	if err != nil {
+		return file, fmt.Errorf("failed to decode RELEASE_NOTES.md: %w", err)
+	}
+	file.sha = fileContent.SHA
+	return file, nil
+}
+
+// commitReleaseNotes writes RELEASE_NOTES.md in config.KrateoRepository, replacing the file read by readReleaseNotes.
+// The file is committed to the default branch, or, when config.PullRequest is set, to the given branch with a pull request
+// to the default branch. The commit goes on top of the branch if it has an open pull request, otherwise the branch is
+// created from, or reset to, the default branch. It returns the URL of the pull request, empty if the file was committed
+// to the default branch
+func commitReleaseNotes(client *github.Client, config configuration.Configuration, file releaseNotesFile, content string, message string, branch string, title string) (string, error) {
+	ctx := requestContext()
+	owner := config.InstallerOrganization
+	repo := config.KrateoRepository
+
+	if !config.PullRequest {
+		_, _, err := client.Repositories.UpdateFile(ctx, owner, repo, "RELEASE_NOTES.md", &github.RepositoryContentFileOptions{
+			Message: github.Ptr(message),
+			Content: []byte(content),
+			SHA:     file.sha,
+		})
+		return "", err
+	}
+
+	repository, _, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return "", fmt.Errorf("failed to get repository %s/%s: %w", owner, repo, err)
+	}
+	base := repository.GetDefaultBranch()
+
+	if file.pullRequest == nil {
+		baseRef, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+base)
+		if err != nil {
+			return "", fmt.Errorf("failed to get branch %s: %w", base, err)
+		}
+		ref := &github.Reference{
+			Ref:    github.Ptr("refs/heads/" + branch),
+			Object: &github.GitObject{SHA: baseRef.GetObject().SHA},
+		}
+		if file.branchExists {
+			// Nobody is reviewing the branch, its commits were merged or abandoned
+			_, _, err = client.Git.UpdateRef(ctx, owner, repo, ref, true)
+			if err != nil {
+				return "", fmt.Errorf("failed to reset branch %s: %w", branch, err)
+			}
+			log.Info().Msgf("Branch %s reset to %s", branch, base)
+		} else {
+			_, _, err = client.Git.CreateRef(ctx, owner, repo, ref)
+			if err != nil {
+				return "", fmt.Errorf("failed to create branch %s: %w", branch, err)
+			}
+			log.Info().Msgf("Branch %s created from %s", branch, base)
+		}
+	}
+
+	// The commit goes on top of the branch, the SHA of the file was read from the same commit
+	_, _, err = client.Repositories.UpdateFile(ctx, owner, repo, "RELEASE_NOTES.md", &github.RepositoryContentFileOptions{
+		Message: github.Ptr(message),
+		Content: []byte(content),
+		SHA:     file.sha,
+		Branch:  github.Ptr(branch),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to commit on branch %s: %w", branch, err)
+	}
+	log.Info().Msgf("RELEASE_NOTES.md committed on branch %s", branch)
+
+	// Update the open pull request of the branch, if any
+	body := fmt.Sprintf("%s\n\nThis pull request was created by installer-release-parser.", message)
+	var pull *github.PullRequest
+	if file.pullRequest != nil {
+		pull, _, err = client.PullRequests.Edit(ctx, owner, repo, file.pullRequest.GetNumber(), &github.PullRequest{
+			Title: github.Ptr(title),
+			Body:  github.Ptr(body),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to update pull request #%d: %w", file.pullRequest.GetNumber(), err)
+		}
+		log.Info().Msgf("Pull request #%d updated", pull.GetNumber())
+	} else {
+		pull, _, err = client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+			Title: github.Ptr(title),
+			Head:  github.Ptr(branch),
+			Base:  github.Ptr(base),
+			Body:  github.Ptr(body),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to create pull request: %w", err)
+		}
+		log.Info().Msgf("Pull request #%d created", pull.GetNumber())
+	}
+
+	if len(config.PullRequestLabels) > 0 {
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, owner, repo, pull.GetNumber(), config.PullRequestLabels); err != nil {
+			log.Warn().Err(err).Msgf("could not add labels to pull request #%d", pull.GetNumber())
+		}
+	}
+
+	// Reviewers in the org/team form are requested as teams
+	if len(config.PullRequestReviewers) > 0 {
+		reviewers := github.ReviewersRequest{}
+		for _, reviewer := range config.PullRequestReviewers {
+			if _, team, ok := strings.Cut(reviewer, "/"); ok {
+				reviewers.TeamReviewers = append(reviewers.TeamReviewers, team)
+			} else {
+				reviewers.Reviewers = append(reviewers.Reviewers, reviewer)
+			}
+		}
+		if _, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, pull.GetNumber(), reviewers); err != nil {
+			log.Warn().Err(err).Msgf("could not request reviewers for pull request #%d", pull.GetNumber())
+		}
+	}
+
+	return pull.GetHTMLURL(), nil
+}
@@ -0,0 +1,168 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v72/github"
+	"github.com/rs/zerolog/log"
+)
+
+// RetryOptions holds the settings of the retries of the GitHub requests
+type RetryOptions struct {
+	// Maximum number of retries of a request, 0 disables the retries
+	MaxRetries int
+	// Longest wait before a retry, requests that would wait longer (e.g., until the reset of an exhausted quota) fail immediately
+	MaxWait time.Duration
+}
+
+// retryTransport retries the requests failed because of rate limits, and the idempotent requests failed because of
+// server errors or transport errors
+type retryTransport struct {
+	base http.RoundTripper
+	opts RetryOptions
+}
+
+// NewRetryTransport returns a transport that waits for the rate limits to reset and retries the transient failures with backoff
+func NewRetryTransport(opts RetryOptions) http.RoundTripper {
+	return &retryTransport{base: http.DefaultTransport, opts: opts}
+}
+
+// requestContext returns the context of the API calls. The rate limits are handled by the transport,
+// so the client must not fail the requests in advance when it knows that the quota is exhausted
+func requestContext() context.Context {
+	return context.WithValue(context.Background(), github.BypassRateLimitCheck, true)
+}
+
+func (t *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		attemptRequest := request
+		if attempt > 0 && request.Body != nil {
+			// Requests with a body can only be retried if the body can be read again
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptRequest = request.Clone(request.Context())
+			attemptRequest.Body = body
+		}
+
+		response, err := t.base.RoundTrip(attemptRequest)
+		logQuota(response)
+
+		wait, reason := retryDelay(response, err, attempt, isSafeToRetry(request))
+		if reason == "" || attempt >= t.opts.MaxRetries || (request.Body != nil && request.GetBody == nil) {
+			return response, err
+		}
+		if t.opts.MaxWait > 0 && wait > t.opts.MaxWait {
+			log.Warn().Msgf("%s %s: %s, not retrying as the wait of %s is longer than %s", request.Method, request.URL.Path, reason, wait.Round(time.Second), t.opts.MaxWait)
+			return response, err
+		}
+
+		log.Warn().Msgf("%s %s: %s, retrying in %s (%d/%d)", request.Method, request.URL.Path, reason, wait.Round(time.Second), attempt+1, t.opts.MaxRetries)
+		if response != nil {
+			_, _ = io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-request.Context().Done():
+			return nil, request.Context().Err()
+		}
+	}
+}
+
+// isSafeToRetry tells whether the request can be repeated safely after a server or transport error, which GitHub may
+// have processed anyway. PUT is excluded, since file updates carry the SHA of the file they replace.
+// The generation of release notes is a POST that does not change anything, so it is retried too
+func isSafeToRetry(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPatch:
+		return true
+	case http.MethodPost:
+		return strings.HasSuffix(request.URL.Path, "/releases/generate-notes")
+	}
+	return false
+}
+
+// retryDelay returns how long to wait before retrying the request and why, or an empty reason if it must not be retried.
+// Rate limited requests were not processed and are always retried, the others only if safe to retry
+func retryDelay(response *http.Response, err error, attempt int, safe bool) (time.Duration, string) {
+	if err != nil {
+		if !safe || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, ""
+		}
+		return backoff(time.Second, attempt), fmt.Sprintf("transport error (%s)", err)
+	}
+
+	switch response.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		// Secondary rate limits tell how long to wait
+		if retryAfter, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			return time.Duration(retryAfter) * time.Second, "secondary rate limit exceeded"
+		}
+		// Primary rate limits reset at a given time
+		if response.Header.Get("X-RateLimit-Remaining") == "0" {
+			reset, err := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64)
+			if err == nil {
+				return max(time.Until(time.Unix(reset, 0))+time.Second, time.Second), "rate limit exhausted"
+			}
+		}
+		// Secondary rate limits without Retry-After require waiting at least one minute, increasing exponentially
+		if isSecondaryRateLimit(response) {
+			return time.Minute << attempt, "secondary rate limit exceeded"
+		}
+		if response.StatusCode == http.StatusTooManyRequests {
+			return backoff(time.Second, attempt), "too many requests"
+		}
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if !safe {
+			return 0, ""
+		}
+		return backoff(time.Second, attempt), fmt.Sprintf("server error %d", response.StatusCode)
+	}
+	return 0, ""
+}
+
+// isSecondaryRateLimit reads the body of the response, leaving it readable, to find the secondary rate limit message
+func isSecondaryRateLimit(response *http.Response) bool {
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return err == nil && strings.Contains(strings.ToLower(string(body)), "secondary rate limit")
+}
+
+// backoff doubles base at each attempt, up to 30 seconds, with a random jitter of up to half of the delay
+func backoff(base time.Duration, attempt int) time.Duration {
+	delay := min(base<<attempt, 30*time.Second)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// logQuota logs the remaining requests of the rate limit of the response, warning when less than 10% are left
+func logQuota(response *http.Response) {
+	if response == nil {
+		return
+	}
+	remaining, err := strconv.Atoi(response.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(response.Header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(response.Header.Get("X-RateLimit-Reset"), 10, 64)
+	resource := response.Header.Get("X-RateLimit-Resource")
+
+	event := log.Debug()
+	if remaining*10 < limit {
+		event = log.Warn()
+	}
+	event.Msgf("GitHub %s quota: %d/%d requests left, resets at %s", resource, remaining, limit, time.Unix(reset, 0).Format(time.TimeOnly))
+}
@@ -0,0 +1,199 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testResponse(status int, headers map[string]string, body string) *http.Response {
+	header := http.Header{}
+	for key, value := range headers {
+		header.Set(key, value)
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestRetryDelay(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10)
+	transportErr := errors.New("connection reset by peer")
+
+	tests := []struct {
+		name     string
+		response *http.Response
+		err      error
+		attempt  int
+		safe     bool
+		retry    bool
+		// Expected wait, between min and max
+		min time.Duration
+		max time.Duration
+	}{
+		{
+			name:     "success",
+			response: testResponse(http.StatusOK, nil, "{}"),
+			safe:     true,
+		},
+		{
+			name:     "not found",
+			response: testResponse(http.StatusNotFound, nil, `{"message":"Not Found"}`),
+			safe:     true,
+		},
+		{
+			name:     "forbidden without rate limit",
+			response: testResponse(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "4000"}, `{"message":"Resource not accessible"}`),
+			safe:     true,
+		},
+		{
+			name:     "primary rate limit",
+			response: testResponse(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset}, `{"message":"API rate limit exceeded"}`),
+			retry:    true,
+			min:      9 * time.Minute,
+			max:      11 * time.Minute,
+		},
+		{
+			name:     "primary rate limit already reset",
+			response: testResponse(http.StatusForbidden, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1"}, `{"message":"API rate limit exceeded"}`),
+			retry:    true,
+			min:      time.Second,
+			max:      time.Second,
+		},
+		{
+			name:     "secondary rate limit with Retry-After",
+			response: testResponse(http.StatusForbidden, map[string]string{"Retry-After": "42"}, `{"message":"You have exceeded a secondary rate limit"}`),
+			retry:    true,
+			min:      42 * time.Second,
+			max:      42 * time.Second,
+		},
+		{
+			name:     "secondary rate limit with Retry-After on 429",
+			response: testResponse(http.StatusTooManyRequests, map[string]string{"Retry-After": "5"}, ""),
+			retry:    true,
+			min:      5 * time.Second,
+			max:      5 * time.Second,
+		},
+		{
+			name:     "secondary rate limit without Retry-After",
+			response: testResponse(http.StatusForbidden, nil, `{"message":"You have exceeded a secondary rate limit. Please wait a few minutes before you try again."}`),
+			retry:    true,
+			min:      time.Minute,
+			max:      time.Minute,
+		},
+		{
+			name:     "secondary rate limit without Retry-After increases",
+			response: testResponse(http.StatusForbidden, nil, `{"message":"You have exceeded a secondary rate limit."}`),
+			attempt:  2,
+			retry:    true,
+			min:      4 * time.Minute,
+			max:      4 * time.Minute,
+		},
+		{
+			name:     "too many requests",
+			response: testResponse(http.StatusTooManyRequests, nil, ""),
+			retry:    true,
+			min:      500 * time.Millisecond,
+			max:      time.Second,
+		},
+		{
+			name:     "server error on safe request",
+			response: testResponse(http.StatusBadGateway, nil, ""),
+			attempt:  1,
+			safe:     true,
+			retry:    true,
+			min:      time.Second,
+			max:      2 * time.Second,
+		},
+		{
+			name:     "server error backoff capped",
+			response: testResponse(http.StatusServiceUnavailable, nil, ""),
+			attempt:  10,
+			safe:     true,
+			retry:    true,
+			min:      15 * time.Second,
+			max:      30 * time.Second,
+		},
+		{
+			name:     "server error on unsafe request",
+			response: testResponse(http.StatusInternalServerError, nil, ""),
+		},
+		{
+			name:  "transport error on safe request",
+			err:   transportErr,
+			safe:  true,
+			retry: true,
+			min:   500 * time.Millisecond,
+			max:   time.Second,
+		},
+		{
+			name: "transport error on unsafe request",
+			err:  transportErr,
+		},
+		{
+			name: "canceled",
+			err:  context.Canceled,
+			safe: true,
+		},
+		{
+			name: "deadline exceeded",
+			err:  context.DeadlineExceeded,
+			safe: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wait, reason := retryDelay(test.response, test.err, test.attempt, test.safe)
+			if (reason != "") != test.retry {
+				t.Fatalf("got reason %q, want retry %t", reason, test.retry)
+			}
+			if test.retry && (wait < test.min || wait > test.max) {
+				t.Errorf("got wait %s, want between %s and %s", wait, test.min, test.max)
+			}
+		})
+	}
+}
+
+func TestRetryDelayKeepsBody(t *testing.T) {
+	body := `{"message":"Resource not accessible"}`
+	r := testResponse(http.StatusForbidden, nil, body)
+	retryDelay(r, nil, 0, true)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil || string(data) != body {
+		t.Errorf("got body %q (%v), want %q", data, err, body)
+	}
+}
+
+func TestIsSafeToRetry(t *testing.T) {
+	tests := []struct {
+		method string
+		url    string
+		want   bool
+	}{
+		{method: http.MethodGet, url: "https://api.github.com/repos/o/r/releases/tags/1.0.0", want: true},
+		{method: http.MethodHead, url: "https://api.github.com/repos/o/r", want: true},
+		{method: http.MethodPatch, url: "https://api.github.com/repos/o/r/releases/1", want: true},
+		{method: http.MethodPost, url: "https://api.github.com/repos/o/r/releases/generate-notes", want: true},
+		{method: http.MethodPost, url: "https://github.example.com/api/v3/repos/o/r/releases/generate-notes", want: true},
+		{method: http.MethodPost, url: "https://api.github.com/repos/o/r/releases", want: false},
+		{method: http.MethodPost, url: "https://api.github.com/repos/o/r/git/commits", want: false},
+		{method: http.MethodPost, url: "https://api.github.com/repos/o/r/pulls", want: false},
+		{method: http.MethodPut, url: "https://api.github.com/repos/o/r/contents/RELEASE_NOTES.md", want: false},
+		{method: http.MethodDelete, url: "https://api.github.com/repos/o/r/git/refs/heads/b", want: false},
+	}
+
+	for _, test := range tests {
+		request, err := http.NewRequest(test.method, test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isSafeToRetry(request); got != test.want {
+			t.Errorf("%s %s: got %t, want %t", test.method, test.url, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package github
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-github/v72/github"
+	"github.com/rs/zerolog/log"
+
+	"installer-release-parser/internal/helpers/configuration"
+)
+
+// ReleaseSettings holds the state of a new installer release
+type ReleaseSettings struct {
+	Draft      bool
+	Prerelease bool
+	// true, false or legacy, see the make_latest field of the GitHub API
+	MakeLatest string
+}
+
+func (s ReleaseSettings) String() string {
+	return fmt.Sprintf("draft %t, prerelease %t, latest %s", s.Draft, s.Prerelease, s.MakeLatest)
+}
+
+// releaseSettings resolves the release settings from the configuration. With config.ReleasePrerelease set to auto,
+// versions with a semver pre-release (e.g., 2.6.0-rc.1) are pre-releases. Unless set, make_latest is false for drafts and pre-releases
+func releaseSettings(config configuration.Configuration) ReleaseSettings {
+	settings := ReleaseSettings{
+		Draft:      config.ReleaseDraft,
+		MakeLatest: config.MakeLatest,
+	}
+
+	switch config.ReleasePrerelease {
+	case "true":
+		settings.Prerelease = true
+	case "false":
+		settings.Prerelease = false
+	default:
+		version, err := semver.NewVersion(config.InstallerChartVersion)
+		settings.Prerelease = err == nil && version.Prerelease() != ""
+	}
+
+	if settings.MakeLatest == "" {
+		settings.MakeLatest = "true"
+		if settings.Draft || settings.Prerelease {
+			settings.MakeLatest = "false"
+		}
+	}
+	return settings
+}
+
+// findRelease returns the release of the tag, including the drafts, which are not returned by GetReleaseByTag.
+// It returns nil if there is no release for the tag
+func findRelease(client *github.Client, owner string, repository string, tag string) (*github.RepositoryRelease, error) {
+	release, response, err := client.Repositories.GetReleaseByTag(requestContext(), owner, repository, tag)
+	if err == nil {
+		return release, nil
+	}
+	if response == nil || response.StatusCode != 404 {
+		return nil, err
+	}
+
+	// Drafts are only listed
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		releases, response, err := client.Repositories.ListReleases(requestContext(), owner, repository, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list releases of %s/%s: %w", owner, repository, err)
+		}
+		for _, release := range releases {
+			if release.GetDraft() && release.GetTagName() == tag {
+				return release, nil
+			}
+		}
+		if response.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = response.NextPage
+	}
+}
+
+// PromoteInstallerRelease publishes the draft release of the installer version, keeping its pre-release state.
+// In dry run, the change is only printed to stdout
+func PromoteInstallerRelease(clients *ClientPool, config configuration.Configuration) error {
+	client := clients.For(config.InstallerOrganization)
+
+	release, err := findRelease(client, config.InstallerOrganization, config.InstallerChartGithubRepository, config.InstallerChartVersion)
+	if err != nil {
+		return &PublishError{Step: "get the release for tag " + config.InstallerChartVersion, Err: err}
+	}
+	if release == nil {
+		return &PublishError{Step: "promote the release for tag " + config.InstallerChartVersion, Err: fmt.Errorf("release not found")}
+	}
+	if !release.GetDraft() {
+		log.Info().Msgf("Release %d for tag %s is already published", release.GetID(), config.InstallerChartVersion)
+		return nil
+	}
+
+	makeLatest := config.MakeLatest
+	if makeLatest == "" {
+		makeLatest = "true"
+		if release.GetPrerelease() {
+			makeLatest = "false"
+		}
+	}
+
+	if config.DryRun {
+		printPlan("publish draft release %d on %s/%s: tag %s, title %q, prerelease %t, latest %s", release.GetID(), config.InstallerOrganization, config.InstallerChartGithubRepository, release.GetTagName(), release.GetName(), release.GetPrerelease(), makeLatest)
+		return nil
+	}
+
+	_, response, err := client.Repositories.EditRelease(requestContext(), config.InstallerOrganization, config.InstallerChartGithubRepository, release.GetID(), &github.RepositoryRelease{
+		Draft:      github.Ptr(false),
+		MakeLatest: stringPointer(makeLatest),
+	})
+	if err != nil {
+		log.Debug().Msgf("Body %s", responseBody(response))
+		return &PublishError{Step: fmt.Sprintf("publish release %d", release.GetID()), Err: err}
+	}
+	log.Info().Msgf("Release %d published for tag %s", release.GetID(), config.InstallerChartVersion)
+	return nil
+}
@@ -0,0 +1,105 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Resolver finds the organization hosting each repository among the configured organizations.
+// Results are cached for the whole run, so each repository is looked up at most once per organization
+type Resolver struct {
+	clients *ClientPool
+	owners  []string
+	// Organization of each repository by lowercase name, empty if no organization hosts it
+	cache map[string]string
+}
+
+func NewResolver(clients *ClientPool, owners []string) *Resolver {
+	return &Resolver{
+		clients: clients,
+		owners:  owners,
+		cache:   map[string]string{},
+	}
+}
+
+// Resolve returns the organization hosting the repository. The organizations found in the sources (GitHub URLs,
+// image repositories) are looked up first, then the other configured organizations in order.
+// Lookup errors other than not found are not cached, so the repository is looked up again on the next call
+func (r *Resolver) Resolve(repository string, sources []string) (string, error) {
+	name := strings.ToLower(repository)
+	if owner, ok := r.cache[name]; ok {
+		if owner == "" {
+			return "", fmt.Errorf("repository %s not found in %s", repository, strings.Join(r.owners, ", "))
+		}
+		return owner, nil
+	}
+	if len(r.owners) == 0 {
+		return "", fmt.Errorf("no organization to search")
+	}
+
+	var lastErr error
+	for _, owner := range r.candidates(sources) {
+		_, response, err := r.clients.For(owner).Repositories.Get(requestContext(), owner, repository)
+		if err == nil {
+			log.Debug().Msgf("%s: found in %s", repository, owner)
+			r.cache[name] = owner
+			return owner, nil
+		}
+		if response == nil || response.StatusCode != http.StatusNotFound {
+			log.Debug().Err(err).Msgf("%s: could not look up the repository in %s", repository, owner)
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return "", fmt.Errorf("failed to look up repository %s: %w", repository, lastErr)
+	}
+
+	r.cache[name] = ""
+	return "", fmt.Errorf("repository %s not found in %s", repository, strings.Join(r.owners, ", "))
+}
+
+// candidates returns the configured organizations, the ones found in the sources first
+func (r *Resolver) candidates(sources []string) []string {
+	candidates := []string{}
+	for _, source := range sources {
+		hint := sourceOwner(source)
+		index := slices.IndexFunc(r.owners, func(owner string) bool { return strings.EqualFold(owner, hint) })
+		if index >= 0 && !slices.Contains(candidates, r.owners[index]) {
+			candidates = append(candidates, r.owners[index])
+		}
+	}
+	for _, owner := range r.owners {
+		if !slices.Contains(candidates, owner) {
+			candidates = append(candidates, owner)
+		}
+	}
+	return candidates
+}
+
+// sourceOwner returns the owner in a GitHub URL (e.g., https://github.com/krateoplatformops/core-provider)
+// or in an image repository (e.g., ghcr.io/krateoplatformops/core-provider), empty if there is none
+func sourceOwner(source string) string {
+	source = strings.TrimSuffix(strings.TrimSpace(source), "/")
+	if _, after, ok := strings.Cut(source, "://"); ok {
+		source = after
+	}
+	source = strings.Replace(source, "git@github.com:", "github.com/", 1)
+	source = strings.TrimPrefix(source, "www.")
+
+	parts := strings.Split(source, "/")
+	if strings.EqualFold(parts[0], "github.com") {
+		if len(parts) < 2 {
+			return ""
+		}
+		return parts[1]
+	}
+	// The owner of an image precedes its name, after the registry host if any
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
@@ -0,0 +1,161 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/rs/zerolog/log"
+
+	"installer-release-parser/apis"
+)
+
+// Cache stores pulled chart archives on disk. Published chart versions are immutable,
+// so archives are addressed by registry, name and version and never refreshed
+type Cache struct {
+	Dir string
+	// Maximum size of the cache in bytes, the least recently used archives are evicted above it. No limit if zero
+	MaxSize int64
+	// If true, charts missing from the cache are not pulled and the fetch fails immediately
+	Offline bool
+
+	mu sync.RWMutex
+}
+
+// NewCache creates the cache directory, an empty dir defaults to the user cache directory
+func NewCache(dir string, maxSize int64, offline bool) (*Cache, error) {
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find user cache directory: %w", err)
+		}
+		dir = filepath.Join(userCacheDir, "installer-release-parser", "charts")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+	}
+
+	return &Cache{Dir: dir, MaxSize: maxSize, Offline: offline}, nil
+}
+
+// Expand extracts the cached archive of the chart in destDir, returning false if the chart is not cached
+func (c *Cache) Expand(chart apis.Chart, destDir string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	archive := c.path(chart)
+	if _, err := os.Stat(archive); err != nil {
+		return false, nil
+	}
+
+	// Track the last use for the eviction
+	now := time.Now()
+	if err := os.Chtimes(archive, now, now); err != nil {
+		log.Debug().Err(err).Msgf("could not update cache access time of %s", archive)
+	}
+
+	if err := chartutil.ExpandFile(destDir, archive); err != nil {
+		return true, fmt.Errorf("failed to extract cached chart %s: %w", archive, err)
+	}
+	return true, nil
+}
+
+// Put copies the archive of the chart in the cache, then evicts old entries above MaxSize
+func (c *Cache) Put(chart apis.Chart, archive string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	source, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	// Write to a temporary file first, so that concurrent readers never see a partial archive
+	tmp, err := os.CreateTemp(c.Dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, source); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path(chart)); err != nil {
+		return err
+	}
+
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used archives until the cache fits in MaxSize
+func (c *Cache) evict() {
+	if c.MaxSize <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		log.Warn().Err(err).Msgf("could not list cache directory %s", c.Dir)
+		return
+	}
+
+	files := []os.FileInfo{}
+	size := int64(0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tgz") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		size += info.Size()
+	}
+
+	slices.SortFunc(files, func(a, b os.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+
+	for _, file := range files {
+		if size <= c.MaxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.Dir, file.Name())); err != nil {
+			log.Warn().Err(err).Msgf("could not evict %s from cache", file.Name())
+			continue
+		}
+		log.Debug().Msgf("Evicted %s from cache", file.Name())
+		size -= file.Size()
+	}
+}
+
+func (c *Cache) path(chart apis.Chart) string {
+	return filepath.Join(c.Dir, cacheKey(chart)+".tgz")
+}
+
+// cacheKey is the hash of the registry, name and version of the chart
+func cacheKey(chart apis.Chart) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strings.TrimSuffix(chart.Registry, "/"),
+		chart.Repository,
+		chart.Version,
+	}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+package helm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rs/zerolog/log"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// RegistryConfig holds the authentication and TLS settings of a chart registry
+type RegistryConfig struct {
+	// URL prefix of the chart registries the settings apply to, e.g., https://charts.example.com or oci://ghcr.io/org.
+	// Without scheme it matches any scheme, when empty it matches every registry
+	URL      string `json:"url" yaml:"url"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	// Environment variable holding the password, used when Password is empty
+	PasswordEnv           string `json:"passwordEnv" yaml:"passwordEnv"`
+	CertFile              string `json:"certFile" yaml:"certFile"`
+	KeyFile               string `json:"keyFile" yaml:"keyFile"`
+	CAFile                string `json:"caFile" yaml:"caFile"`
+	InsecureSkipTLSVerify bool   `json:"insecureSkipTLSVerify" yaml:"insecureSkipTLSVerify"`
+	PlainHTTP             bool   `json:"plainHTTP" yaml:"plainHTTP"`
+	// Send the credentials to every domain the chart is downloaded from, not only the registry one
+	PassCredentialsAll bool `json:"passCredentialsAll" yaml:"passCredentialsAll"`
+}
+
+// Registries are the settings of the known chart registries, the longest matching URL wins
+type Registries []RegistryConfig
+
+// LoadRegistries reads a YAML or JSON file with a list of registries under the registries key
+func LoadRegistries(path string) (Registries, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registries config %s: %w", path, err)
+	}
+
+	var file struct {
+		Registries Registries `json:"registries" yaml:"registries"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal registries config %s: %w", path, err)
+	}
+
+	for i := range file.Registries {
+		if file.Registries[i].Password == "" && file.Registries[i].PasswordEnv != "" {
+			file.Registries[i].Password = os.Getenv(file.Registries[i].PasswordEnv)
+		}
+	}
+	return file.Registries, nil
+}
+
+// HelmRepositories reads the repositories added with `helm repo add` from Helm's repositories.yaml
+// (HELM_REPOSITORY_CONFIG). A missing file returns no registries
+func HelmRepositories() Registries {
+	repositoryConfig := cli.New().RepositoryConfig
+	file, err := repo.LoadFile(repositoryConfig)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Debug().Err(err).Msgf("could not read Helm repositories from %s", repositoryConfig)
+		}
+		return nil
+	}
+
+	registries := Registries{}
+	for _, entry := range file.Repositories {
+		registries = append(registries, RegistryConfig{
+			URL:                   entry.URL,
+			Username:              entry.Username,
+			Password:              entry.Password,
+			CertFile:              entry.CertFile,
+			KeyFile:               entry.KeyFile,
+			CAFile:                entry.CAFile,
+			InsecureSkipTLSVerify: entry.InsecureSkipTLSverify,
+			PassCredentialsAll:    entry.PassCredentialsAll,
+		})
+	}
+	return registries
+}
+
+// RegistryHostURL returns the scheme and host of the registry URL (e.g., oci://ghcr.io for oci://ghcr.io/org/charts),
+// to apply settings to the registry host only
+func RegistryHostURL(registryURL string) (string, error) {
+	parsed, err := url.Parse(registryURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse registry %s: %w", registryURL, err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return "", fmt.Errorf("registry %s has no scheme or host", registryURL)
+	}
+	return parsed.Scheme + "://" + parsed.Host, nil
+}
+
+// For returns the settings of the registry, empty settings (anonymous, default TLS) if none matches
+func (r Registries) For(registryURL string) RegistryConfig {
+	result := RegistryConfig{}
+	longest := -1
+	for _, config := range r {
+		length := matchLength(config.URL, registryURL)
+		if length > longest {
+			result = config
+			longest = length
+		}
+	}
+	return result
+}
+
+// matchLength returns the length of the prefix matching the registry, -1 if it does not match.
+// A prefix matches on path boundaries (https://a/b matches https://a/b/c but not https://a/bc),
+// a scheme alone (e.g., oci://) matches every registry with that scheme
+func matchLength(prefix string, registryURL string) int {
+	if strings.HasSuffix(prefix, "://") {
+		if strings.HasPrefix(registryURL, prefix) {
+			return len(prefix)
+		}
+		return -1
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	target := strings.TrimSuffix(registryURL, "/")
+	if !strings.Contains(prefix, "://") {
+		if _, withoutScheme, found := strings.Cut(target, "://"); found {
+			target = withoutScheme
+		}
+	}
+
+	if prefix == "" || target == prefix || strings.HasPrefix(target, prefix+"/") {
+		return len(prefix)
+	}
+	return -1
+}
+
+// tlsConfig builds the TLS configuration of the registry, nil if the defaults apply
+func (c RegistryConfig) tlsConfig() (*tls.Config, error) {
+	if c.CertFile == "" && c.KeyFile == "" && c.CAFile == "" && !c.InsecureSkipTLSVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipTLSVerify,
+	}
+
+	if c.CertFile != "" && c.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %w", c.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
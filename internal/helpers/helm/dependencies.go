@@ -0,0 +1,133 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/rs/zerolog/log"
+	yaml "gopkg.in/yaml.v3"
+
+	"installer-release-parser/apis"
+	"installer-release-parser/internal/helpers/repositories"
+)
+
+// chartDependency represents a dependency in Chart.yaml and Chart.lock
+type chartDependency struct {
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version"`
+	Repository string `yaml:"repository"`
+	Alias      string `yaml:"alias"`
+	Condition  string `yaml:"condition"`
+}
+
+// chartDependencies represents the dependencies section shared by Chart.yaml and Chart.lock
+type chartDependencies struct {
+	Dependencies []chartDependency `yaml:"dependencies"`
+}
+
+// readDependencies lists the dependencies of the chart in chartDir as components, keyed by alias or name.
+// Versions are taken from Chart.lock when available, since Chart.yaml may declare ranges.
+// Dependencies disabled by their condition in values, local (file://) dependencies and
+// repositories referenced by name are skipped
+func readDependencies(chartDir string, values map[string]any, mapping repositories.Mapping) ([]component, error) {
+	declared, err := readChartDependencies(filepath.Join(chartDir, "Chart.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(declared) == 0 {
+		return nil, nil
+	}
+
+	locked, err := readChartDependencies(filepath.Join(chartDir, "Chart.lock"))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Msg("could not read Chart.lock, using Chart.yaml versions")
+	}
+
+	components := []component{}
+	for _, dependency := range declared {
+		key := dependency.Name
+		if dependency.Alias != "" {
+			key = dependency.Alias
+		}
+
+		if enabled, found := dependencyEnabled(values, dependency.Condition); found && !enabled {
+			log.Info().Msgf("Skipping dependency %s: disabled by %s", key, dependency.Condition)
+			continue
+		}
+
+		if strings.HasPrefix(dependency.Repository, "file://") || dependency.Repository == "" {
+			log.Warn().Msgf("Skipping dependency %s: local dependencies are not supported", key)
+			continue
+		}
+		if strings.HasPrefix(dependency.Repository, "@") || strings.HasPrefix(dependency.Repository, "alias:") {
+			log.Warn().Msgf("Skipping dependency %s: repository %s is referenced by name", key, dependency.Repository)
+			continue
+		}
+
+		version := dependency.Version
+		for _, lock := range locked {
+			if lock.Name == dependency.Name && lock.Repository == dependency.Repository {
+				version = lock.Version
+				break
+			}
+		}
+		if _, err := semver.NewVersion(version); err != nil {
+			log.Warn().Msgf("Skipping dependency %s: version %s is not locked, run helm dependency update", key, version)
+			continue
+		}
+
+		imageName := dependency.Name
+		organization := ""
+		if value, ok := mapping.Lookup(key); ok {
+			imageName = value.Name
+			organization = value.Organization
+		}
+
+		components = append(components, component{
+			key:          key,
+			imageName:    imageName,
+			organization: organization,
+			chart: apis.Chart{
+				Repository: dependency.Name,
+				Version:    version,
+				Registry:   dependency.Repository,
+			},
+		})
+	}
+	return components, nil
+}
+
+func readChartDependencies(path string) ([]chartDependency, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file chartDependencies
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	return file.Dependencies, nil
+}
+
+// dependencyEnabled evaluates a dependency condition like Helm does: the first
+// comma separated path holding a boolean in values decides, found is false if none does
+func dependencyEnabled(values map[string]any, condition string) (enabled bool, found bool) {
+	for _, path := range strings.Split(condition, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		matches, err := selectAll(values, path)
+		if err != nil {
+			continue
+		}
+		if enabled, ok := matches[""].(bool); ok {
+			return enabled, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,17 @@
+package helm
+
+import "fmt"
+
+// ComponentError is the failure to read a component of the installer chart, which is skipped
+type ComponentError struct {
+	Key string
+	Err error
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Err)
+}
+
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
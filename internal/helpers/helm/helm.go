@@ -2,170 +2,204 @@ package helm
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
-
-	"helm.sh/helm/v3/pkg/action"
-	"helm.sh/helm/v3/pkg/cli"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	yaml "gopkg.in/yaml.v3"
 
 	"installer-release-parser/apis"
+	"installer-release-parser/internal/helpers/repositories"
 )
 
 const (
-	CHART_DIR = "./charts"
+	// Sub-directory of the destination directory where each component chart is extracted in its own folder
+	COMPONENTS_DIR = "components"
 )
 
 // ChartMetadata represents the structure of Chart.yaml
 type chartMetadata struct {
-	Name       string `yaml:"name"`
-	Version    string `yaml:"version"`
-	AppVersion string `yaml:"appVersion"`
+	Name       string   `yaml:"name"`
+	Version    string   `yaml:"version"`
+	AppVersion string   `yaml:"appVersion"`
+	Home       string   `yaml:"home"`
+	Sources    []string `yaml:"sources"`
 }
 
-func Pull(chart apis.Chart) error {
-	settings := cli.New()
-
-	actionConfig := new(action.Configuration)
-	if err := actionConfig.Init(settings.RESTClientGetter(), "default", os.Getenv("HELM_DRIVER"), log.Logger.Debug().Msgf); err != nil {
-		return err
-	}
-
-	client := action.NewPullWithOpts(action.WithConfig(actionConfig))
-	client.DestDir = CHART_DIR
-	client.RepoURL = chart.Registry
-	client.Version = chart.Version
-	client.Untar = true
-	client.Settings = settings
+// Options holds the settings shared by all chart pulls
+type Options struct {
+	// Authentication and TLS settings of the chart registries, pulls are anonymous when none matches
+	Registries Registries
+	// Maximum number of component charts pulled at the same time, 1 pulls them serially
+	Concurrency int
+	// Maximum duration of a single chart pull, no limit if zero
+	Timeout time.Duration
+	// Local cache of pulled charts, disabled if nil
+	Cache *Cache
+	// Layout of the installer values file, DEFAULT_SCHEMA if empty
+	Schema Schema
+	// Repositories of the components without image, repositories.DEFAULT_REPOSITORIES if nil
+	Repositories repositories.Mapping
+}
 
-	result, err := client.Run(chart.Repository)
-	if err != nil {
-		return err
-	}
+// component is a chart listed in the installer values, waiting to be pulled
+type component struct {
+	key       string
+	imageName string
+	// Image repository from the values, empty if the component has no image
+	image string
+	// Organization from the repositories mapping, if any
+	organization string
+	chart        apis.Chart
+	// Sub-charts nested in the component, keyed by parent/child
+	subCharts map[string]apis.Repoes
+}
 
-	log.Debug().Msgf("%s/%s: helm pull result: %s", chart.Registry, chart.Repository, result)
-	return nil
+// Pull downloads and extracts the chart in destDir, returning the chart directory.
+// Registries starting with oci:// are pulled through a registry client, all others as Helm repositories
+func Pull(chart apis.Chart, destDir string, opts Options) (string, error) {
+	return NewChartSource(chart, opts).Fetch(destDir)
 }
 
-func ParseValues() (map[string]apis.Repoes, error) {
-	installerFile, err := os.ReadFile(filepath.Join(CHART_DIR, "installer", "values.yaml"))
+// ParseValues reads the values file of the installer chart in chartDir and pulls every component chart listed in it under destDir.
+// Components that cannot be read are skipped and returned with their error
+func ParseValues(chartDir string, destDir string, opts Options) (map[string]apis.Repoes, []*ComponentError, error) {
+	installerFile, err := os.ReadFile(filepath.Join(chartDir, "values.yaml"))
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
 	var installerValues map[string]any
 	if err := yaml.Unmarshal(installerFile, &installerValues); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
+		return nil, nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
 	}
 
-	krateoplatformopsValues, ok := installerValues["krateoplatformops"].(map[string]any)
-	if !ok {
-		return nil, fmt.Errorf("krateoplatformops key not found or not a map")
+	schema := opts.Schema
+	if schema.Components == "" {
+		schema = DEFAULT_SCHEMA
 	}
 
-	result := map[string]apis.Repoes{}
+	repositoryMapping := opts.Repositories
+	if repositoryMapping == nil {
+		repositoryMapping = repositories.DEFAULT_REPOSITORIES
+	}
 
-	for topLevelKey := range krateoplatformopsValues {
-		topLevelValue, ok := krateoplatformopsValues[topLevelKey].(map[string]any)
-		if !ok {
-			log.Warn().Msgf("Skipping %s: not a map", topLevelKey)
-			continue
+	componentValues, err := selectAll(installerValues, schema.Components)
+	if err != nil {
+		if !schema.Dependencies {
+			return nil, nil, fmt.Errorf("components not found: %w", err)
 		}
+		log.Warn().Err(err).Msg("no components found in values, only reading chart dependencies")
+		componentValues = map[string]any{}
+	}
+	// A selector pointing to a single map lists the components as its keys
+	if values, ok := componentValues[""].(map[string]any); ok && len(componentValues) == 1 {
+		componentValues = values
+	}
 
-		// Check if chart exists
-		chartValue, hasChart := topLevelValue["chart"]
-		if !hasChart {
-			log.Warn().Msgf("Skipping %s: no chart field", topLevelKey)
-			continue
-		}
+	components := []component{}
+	skipped := []*ComponentError{}
 
-		chartMap, ok := chartValue.(map[string]any)
+	for _, topLevelKey := range slices.Sorted(maps.Keys(componentValues)) {
+		topLevelValue, ok := componentValues[topLevelKey].(map[string]any)
 		if !ok {
-			log.Warn().Msgf("Skipping %s: chart is not a map", topLevelKey)
+			log.Warn().Msgf("Skipping %s: not a map", topLevelKey)
+			skipped = append(skipped, &ComponentError{Key: topLevelKey, Err: fmt.Errorf("not a map")})
 			continue
 		}
 
 		// Safely extract chart fields
-		chartName, ok := chartMap["name"].(string)
-		if !ok {
-			log.Warn().Msgf("Skipping %s: chart.name is not a string", topLevelKey)
-			continue
-		}
-
-		chartVersion, ok := chartMap["version"].(string)
-		if !ok {
-			log.Warn().Msgf("Skipping %s: chart.version is not a string", topLevelKey)
-			continue
-		}
-
-		chartRepository, ok := chartMap["repository"].(string)
-		if !ok {
-			log.Warn().Msgf("Skipping %s: chart.repository is not a string", topLevelKey)
+		chart, err := schema.Chart.readChart(topLevelValue)
+		if err != nil {
+			log.Warn().Msgf("Skipping %s: %s", topLevelKey, err)
+			skipped = append(skipped, &ComponentError{Key: topLevelKey, Err: err})
 			continue
 		}
 
 		// Safely extract image repository
-		imageURL, err := getStringFromMap(topLevelValue, "image", "repository")
+		imageURL, err := selectString(topLevelValue, schema.Image)
 		imageURLParts := strings.Split(imageURL, "/")
 		imageName := imageURLParts[len(imageURLParts)-1]
 		if err != nil {
-			log.Warn().Err(err).Msgf("%s: failed to get image.repository", topLevelKey)
-			log.Info().Msgf("Checking %s for hardcoded value", topLevelKey)
-			if value, ok := HARDCODED_REPOSITORIES[topLevelKey]; ok {
-				log.Info().Msgf("Found hardcoded value for %s: %s", topLevelKey, value)
-				imageName = value
+			log.Warn().Err(err).Msgf("%s: failed to get %s", topLevelKey, schema.Image)
+			log.Info().Msgf("Checking %s for mapped repository", topLevelKey)
+			if value, ok := repositoryMapping.Lookup(topLevelKey); ok {
+				log.Info().Msgf("Found mapped repository for %s: %s", topLevelKey, value.Name)
+				imageName = value.Name
 			} else {
-				log.Warn().Err(err).Msgf("Skipping %s: no hardcoded value found", topLevelKey)
+				log.Warn().Err(err).Msgf("Skipping %s: no mapped repository found", topLevelKey)
+				skipped = append(skipped, &ComponentError{Key: topLevelKey, Err: fmt.Errorf("no mapped repository found: %w", err)})
 				continue
 			}
 		}
 
-		err = Pull(apis.Chart{
-			Repository: chartName,
-			Version:    chartVersion,
-			Registry:   chartRepository,
-		})
-		if err != nil {
-			log.Warn().Err(err).Msgf("Skipping %s: failed to download chart", topLevelKey)
-			continue
+		comp := component{
+			key:       topLevelKey,
+			imageName: imageName,
+			image:     imageURL,
+			chart:     chart,
+			subCharts: map[string]apis.Repoes{},
 		}
-
-		appVersion, err := getAppVersionFromChart(chartName)
-		if err != nil {
-			log.Warn().Err(err).Msgf("Skipping %s: failed to obtain chart appVersion", topLevelKey)
-			continue
+		// Mapped organizations apply even when the image is declared
+		if value, ok := repositoryMapping.Lookup(topLevelKey); ok {
+			comp.organization = value.Organization
 		}
 
-		result[topLevelKey] = apis.Repoes{
-			ImageName: imageName,
-			Chart: apis.Chart{
-				Repository: chartName,
-				Version:    chartVersion,
-				AppVersion: appVersion,
-				Registry:   chartRepository,
-			},
+		if schema.SubCharts {
+			subCharts := map[string]apis.Chart{}
+			invalid := map[string]error{}
+			schema.Chart.discoverSubCharts(topLevelValue, "", subCharts, invalid)
+
+			for _, path := range slices.Sorted(maps.Keys(invalid)) {
+				log.Warn().Msgf("Skipping %s sub-chart %s: %s", topLevelKey, path, invalid[path])
+				skipped = append(skipped, &ComponentError{Key: topLevelKey + "/" + path, Err: invalid[path]})
+			}
+			for path, subChart := range subCharts {
+				subChart.AppVersion = subChart.Version
+				comp.subCharts[topLevelKey+"/"+path] = apis.Repoes{
+					ImageName: subChartImageName(path, repositoryMapping),
+					Chart:     subChart,
+				}
+			}
 		}
 
-		if chartEtcd, ok := topLevelValue["etcd"]; ok {
-			chartMap := chartEtcd.(map[string]any)["chart"].(map[string]any)
-			result["etcd"] = apis.Repoes{
-				ImageName: "etcd-chart",
-				Chart: apis.Chart{
-					Repository: chartMap["name"].(string),
-					Version:    chartMap["version"].(string),
-					AppVersion: chartMap["version"].(string),
-					Registry:   chartMap["repository"].(string),
-				},
+		components = append(components, comp)
+	}
+
+	if schema.Dependencies {
+		dependencies, err := readDependencies(chartDir, installerValues, repositoryMapping)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read chart dependencies: %w", err)
+		}
+		for _, dependency := range dependencies {
+			if slices.ContainsFunc(components, func(comp component) bool { return comp.key == dependency.key }) {
+				log.Debug().Msgf("Skipping dependency %s: already listed in values", dependency.key)
+				continue
 			}
+			components = append(components, dependency)
+		}
+	}
+
+	// Pull all component charts to get the appVersion, results keep the order of components
+	pulled, errs := pullComponents(components, filepath.Join(destDir, COMPONENTS_DIR), opts)
+
+	result := map[string]apis.Repoes{}
+	for i, comp := range components {
+		if pulled[i] == nil {
+			skipped = append(skipped, &ComponentError{Key: comp.key, Err: errs[i]})
+			continue
 		}
+		result[comp.key] = *pulled[i]
+		maps.Copy(result, comp.subCharts)
 	}
 
 	if len(result) == 0 {
-		return nil, fmt.Errorf("no valid entries found in krateoplatformops section")
+		return nil, nil, fmt.Errorf("no valid entries found in %s or in the chart dependencies", schema.Components)
 	}
 
-	return result, nil
+	return result, skipped, nil
 }
@@ -3,58 +3,56 @@ package helm
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 
 	yaml "gopkg.in/yaml.v3"
-)
 
-var (
-	HARDCODED_REPOSITORIES = map[string]string{
-		"finopsnotebooks":         "finops-notebooks-chart",
-		"composableportalstarter": "portal",
-		"composableportalbasic":   "composable-portal-basic",
-		"finopspolicies":          "finops-moving-window-policy-chart",
-		"crate":                   "cratedb-chart",
-		"opa":                     "opa-chart",
-	}
+	"installer-release-parser/internal/helpers/repositories"
 )
 
-// Helper function to safely get string from nested map
-func getStringFromMap(m map[string]any, keys ...string) (string, error) {
-	current := m
-	for i, key := range keys[:len(keys)-1] {
-		next, ok := current[key].(map[string]any)
-		if !ok {
-			return "", fmt.Errorf("key path %v not found or not a map at step %d", keys, i)
-		}
-		current = next
-	}
-
-	finalKey := keys[len(keys)-1]
-	value, ok := current[finalKey].(string)
-	if !ok {
-		return "", fmt.Errorf("final key %s not found or not a string", finalKey)
-	}
-	return value, nil
-}
-
-// getAppVersionFromChart reads the Chart.yaml file and extracts the appVersion
-func getAppVersionFromChart(chartName string) (string, error) {
-	chartPath := filepath.Join(CHART_DIR, chartName, "Chart.yaml")
+// readChartMetadata reads the Chart.yaml file in chartDir
+func readChartMetadata(chartDir string) (chartMetadata, error) {
+	chartPath := filepath.Join(chartDir, "Chart.yaml")
 
 	chartFile, err := os.ReadFile(chartPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read Chart.yaml for %s: %w", chartName, err)
+		return chartMetadata{}, fmt.Errorf("failed to read Chart.yaml for %s: %w", chartDir, err)
 	}
 
 	var metadata chartMetadata
 	if err := yaml.Unmarshal(chartFile, &metadata); err != nil {
-		return "", fmt.Errorf("failed to unmarshal Chart.yaml for %s: %w", chartName, err)
+		return chartMetadata{}, fmt.Errorf("failed to unmarshal Chart.yaml for %s: %w", chartDir, err)
 	}
+	return metadata, nil
+}
+
+// appVersion returns the appVersion of the chart, or its version if empty
+func (m chartMetadata) appVersion() string {
+	if m.AppVersion != "" {
+		return m.AppVersion
+	}
+	return m.Version
+}
+
+// sources returns the URLs of the chart pointing to its repositories, after the image of the component if any
+func (m chartMetadata) sources(image string) []string {
+	sources := []string{}
+	for _, source := range append([]string{image, m.Home}, m.Sources...) {
+		if source != "" && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
 
-	if metadata.AppVersion != "" {
-		return metadata.AppVersion, nil
-	} else {
-		return metadata.Version, nil
+// subChartImageName returns the repository of a nested sub-chart: the mapped repository of its
+// key if any, otherwise the key followed by -chart (e.g., etcd-chart)
+func subChartImageName(subChartPath string, mapping repositories.Mapping) string {
+	name := path.Base(subChartPath)
+	if value, ok := mapping.Lookup(name); ok {
+		return value.Name
 	}
+	return name + "-chart"
 }
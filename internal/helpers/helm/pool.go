@@ -0,0 +1,88 @@
+package helm
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"installer-release-parser/apis"
+)
+
+// pullComponents pulls the component charts with at most opts.Concurrency pulls at the same time.
+// Each chart is extracted in its own folder under destDir, so charts sharing a name do not collide.
+// The returned slices follow the order of components, failed pulls are logged and left nil with their error
+func pullComponents(components []component, destDir string, opts Options) ([]*apis.Repoes, []error) {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]*apis.Repoes, len(components))
+	errs := make([]error, len(components))
+	semaphore := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+
+	for i, comp := range components {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			log.Debug().Msgf("Pulling %s chart %s:%s", comp.key, comp.chart.Repository, comp.chart.Version)
+			componentDir, err := fetchWithTimeout(NewChartSource(comp.chart, opts), filepath.Join(destDir, comp.key), opts.Timeout)
+			if err != nil {
+				log.Warn().Err(err).Msgf("Skipping %s: failed to download chart", comp.key)
+				errs[i] = fmt.Errorf("failed to download chart: %w", err)
+				return
+			}
+
+			metadata, err := readChartMetadata(componentDir)
+			if err != nil {
+				log.Warn().Err(err).Msgf("Skipping %s: failed to obtain chart appVersion", comp.key)
+				errs[i] = fmt.Errorf("failed to obtain chart appVersion: %w", err)
+				return
+			}
+
+			chart := comp.chart
+			chart.AppVersion = metadata.appVersion()
+			results[i] = &apis.Repoes{
+				ImageName:    comp.imageName,
+				Organization: comp.organization,
+				Sources:      metadata.sources(comp.image),
+				Chart:        chart,
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results, errs
+}
+
+// fetchWithTimeout stops waiting for the source after timeout.
+// Helm pulls cannot be cancelled, so a timed out pull keeps running in background until the process exits
+func fetchWithTimeout(source ChartSource, destDir string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return source.Fetch(destDir)
+	}
+
+	type fetchResult struct {
+		dir string
+		err error
+	}
+	done := make(chan fetchResult, 1)
+	go func() {
+		dir, err := source.Fetch(destDir)
+		done <- fetchResult{dir: dir, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.dir, result.err
+	case <-time.After(timeout):
+		return "", fmt.Errorf("pull of %s timed out after %s", source, timeout)
+	}
+}
@@ -0,0 +1,89 @@
+package helm
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+	"oras.land/oras-go/v2/registry/remote/auth"
+
+	"installer-release-parser/apis"
+)
+
+const (
+	// Username sent along with the registry token when none is configured,
+	// registries like ghcr.io only check the token
+	DEFAULT_REGISTRY_USERNAME = "token"
+)
+
+// newRegistryClient builds the client used to pull oci:// charts with the registry settings.
+// If a password (or token) is configured it is sent to the chart registry host, otherwise the credentials
+// stored by `helm registry login` (or docker) are used, falling back to anonymous pulls
+func newRegistryClient(settings *cli.EnvSettings, chart apis.Chart, config RegistryConfig) (*registry.Client, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient := &http.Client{Transport: transport}
+
+	clientOpts := []registry.ClientOption{
+		registry.ClientOptEnableCache(true),
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+		registry.ClientOptHTTPClient(httpClient),
+	}
+	if config.PlainHTTP {
+		clientOpts = append(clientOpts, registry.ClientOptPlainHTTP())
+	}
+
+	if config.Password != "" {
+		host, err := registryHost(chart.Registry)
+		if err != nil {
+			return nil, err
+		}
+
+		username := config.Username
+		if username == "" {
+			username = DEFAULT_REGISTRY_USERNAME
+		}
+
+		clientOpts = append(clientOpts, registry.ClientOptAuthorizer(auth.Client{
+			Client: httpClient,
+			Credential: auth.StaticCredential(host, auth.Credential{
+				Username: username,
+				Password: config.Password,
+			}),
+			Cache: auth.NewCache(),
+		}))
+	}
+
+	return registry.NewClient(clientOpts...)
+}
+
+// registryHost returns the host (and port) of an oci:// registry URL
+func registryHost(registryURL string) (string, error) {
+	parsed, err := url.Parse(registryURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse registry %s: %w", registryURL, err)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("registry %s has no host", registryURL)
+	}
+	return parsed.Host, nil
+}
+
+// ociReference builds the full oci:// reference of the chart.
+// Registries that already end with the chart name are used as they are
+func ociReference(chart apis.Chart) string {
+	ref := strings.TrimSuffix(chart.Registry, "/")
+	if path.Base(ref) == chart.Repository {
+		return ref
+	}
+	return ref + "/" + chart.Repository
+}
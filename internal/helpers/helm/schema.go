@@ -0,0 +1,180 @@
+package helm
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"installer-release-parser/apis"
+)
+
+// Schema describes where the components are declared in the values file of the installer chart.
+// Selectors are dot separated keys, with an optional leading "$.", and "*" matches every key of a map
+type Schema struct {
+	// Selector of the components, relative to the root of the values file
+	Components string `json:"components" yaml:"components"`
+	// Selectors of the chart fields, relative to each component
+	Chart ChartSchema `json:"chart" yaml:"chart"`
+	// Selector of the image repository, relative to each component
+	Image string `json:"image" yaml:"image"`
+	// Discover the sub-charts nested at any depth in a component, i.e., the maps matching the Chart selectors.
+	// Sub-charts are not pulled, their version is used as appVersion
+	SubCharts bool `json:"subCharts" yaml:"subCharts"`
+	// List the dependencies of Chart.yaml (with the versions of Chart.lock) as components too.
+	// Components in values take precedence over dependencies with the same alias or name
+	Dependencies bool `json:"dependencies" yaml:"dependencies"`
+}
+
+type ChartSchema struct {
+	Name       string `json:"name" yaml:"name"`
+	Version    string `json:"version" yaml:"version"`
+	Repository string `json:"repository" yaml:"repository"`
+}
+
+var (
+	// Layout of the Krateo installer chart
+	DEFAULT_SCHEMA = Schema{
+		Components: "krateoplatformops.*",
+		Chart: ChartSchema{
+			Name:       "chart.name",
+			Version:    "chart.version",
+			Repository: "chart.repository",
+		},
+		Image:        "image.repository",
+		SubCharts:    true,
+		Dependencies: true,
+	}
+)
+
+// LoadSchema reads a YAML or JSON mapping file, fields missing from the file keep the DEFAULT_SCHEMA value
+func LoadSchema(path string) (Schema, error) {
+	schema := DEFAULT_SCHEMA
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return schema, fmt.Errorf("failed to read schema %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return schema, fmt.Errorf("failed to unmarshal schema %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// readChart extracts the chart fields of a component
+func (s ChartSchema) readChart(value map[string]any) (apis.Chart, error) {
+	name, err := selectString(value, s.Name)
+	if err != nil {
+		return apis.Chart{}, err
+	}
+	version, err := selectString(value, s.Version)
+	if err != nil {
+		return apis.Chart{}, err
+	}
+	repository, err := selectString(value, s.Repository)
+	if err != nil {
+		return apis.Chart{}, err
+	}
+
+	return apis.Chart{
+		Repository: name,
+		Version:    version,
+		Registry:   repository,
+	}, nil
+}
+
+// discoverSubCharts walks the component values and returns the nested maps holding the chart fields, keyed by their path joined with "/".
+// Maps declaring the first key of the chart name selector without valid chart fields are reported in invalid
+func (s ChartSchema) discoverSubCharts(value map[string]any, path string, found map[string]apis.Chart, invalid map[string]error) {
+	marker := ""
+	if segments := splitSelector(s.Name); len(segments) > 0 {
+		marker = segments[0]
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(value)) {
+		child, ok := value[key].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		childPath := key
+		if path != "" {
+			childPath = path + "/" + key
+		}
+
+		chart, err := s.readChart(child)
+		if err == nil {
+			found[childPath] = chart
+		} else if _, ok := child[marker]; ok {
+			invalid[childPath] = err
+		}
+
+		s.discoverSubCharts(child, childPath, found, invalid)
+	}
+}
+
+// selectAll returns the values matching the selector, keyed by the keys matched by the wildcards joined with "/".
+// A selector without wildcards returns a single value with an empty key
+func selectAll(value any, selector string) (map[string]any, error) {
+	result := map[string]any{}
+	if err := walkSelector(value, splitSelector(selector), "", result); err != nil {
+		return nil, fmt.Errorf("selector %s: %w", selector, err)
+	}
+	return result, nil
+}
+
+// selectString returns the string at the selector, which cannot contain wildcards
+func selectString(value any, selector string) (string, error) {
+	matches, err := selectAll(value, selector)
+	if err != nil {
+		return "", err
+	}
+	result, ok := matches[""].(string)
+	if len(matches) != 1 || !ok {
+		return "", fmt.Errorf("%s is not a string", selector)
+	}
+	return result, nil
+}
+
+func splitSelector(selector string) []string {
+	selector = strings.TrimPrefix(strings.TrimPrefix(selector, "$"), ".")
+	if selector == "" {
+		return nil
+	}
+	return strings.Split(selector, ".")
+}
+
+func walkSelector(value any, segments []string, key string, result map[string]any) error {
+	if len(segments) == 0 {
+		result[key] = value
+		return nil
+	}
+
+	current, ok := value.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%s is not a map", strings.Join(segments, "."))
+	}
+
+	if segments[0] != "*" {
+		next, ok := current[segments[0]]
+		if !ok {
+			return fmt.Errorf("%s not found", segments[0])
+		}
+		return walkSelector(next, segments[1:], key, result)
+	}
+
+	for _, child := range slices.Sorted(maps.Keys(current)) {
+		childKey := child
+		if key != "" {
+			childKey = key + "/" + child
+		}
+		// Entries not matching the rest of the selector are left to the caller to report
+		if err := walkSelector(current[child], segments[1:], childKey, result); err != nil {
+			result[childKey] = nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+
+	"github.com/rs/zerolog/log"
+
+	"installer-release-parser/apis"
+)
+
+// ChartSource is a place an unpacked chart can be obtained from
+type ChartSource interface {
+	// Fetch makes the chart available under destDir and returns the path of the chart directory
+	Fetch(destDir string) (string, error)
+	// String describes the source for logging purposes
+	String() string
+}
+
+// RepositorySource pulls a chart from a Helm repository
+type RepositorySource struct {
+	Chart   apis.Chart
+	Options Options
+}
+
+// OCISource pulls a chart from an oci:// registry
+type OCISource struct {
+	Chart   apis.Chart
+	Options Options
+}
+
+// DirectorySource reads an already unpacked chart, e.g., a working copy
+type DirectorySource struct {
+	Path string
+}
+
+// ArchiveSource extracts a packaged chart (.tgz)
+type ArchiveSource struct {
+	Path string
+}
+
+// NewChartSource returns the remote source for the chart, depending on its registry
+func NewChartSource(chart apis.Chart, opts Options) ChartSource {
+	if registry.IsOCI(chart.Registry) {
+		return &OCISource{Chart: chart, Options: opts}
+	}
+	return &RepositorySource{Chart: chart, Options: opts}
+}
+
+// NewLocalChartSource returns the source for a chart on the local filesystem, either a directory or a .tgz archive
+func NewLocalChartSource(path string) (ChartSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local chart %s: %w", path, err)
+	}
+
+	if info.IsDir() {
+		return &DirectorySource{Path: path}, nil
+	}
+	if strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".tar.gz") {
+		return &ArchiveSource{Path: path}, nil
+	}
+	return nil, fmt.Errorf("local chart %s is neither a directory nor a .tgz archive", path)
+}
+
+func (s *RepositorySource) Fetch(destDir string) (string, error) {
+	if chartDir, ok, err := fromCache(s.Chart, destDir, s.Options.Cache); ok || err != nil {
+		return chartDir, err
+	}
+
+	client, err := newPullAction(destDir, s.Chart.Version)
+	if err != nil {
+		return "", err
+	}
+	client.RepoURL = s.Chart.Registry
+
+	config := s.Options.Registries.For(s.Chart.Registry)
+	client.Username = config.Username
+	client.Password = config.Password
+	client.CertFile = config.CertFile
+	client.KeyFile = config.KeyFile
+	client.CaFile = config.CAFile
+	client.InsecureSkipTLSverify = config.InsecureSkipTLSVerify
+	client.PlainHTTP = config.PlainHTTP
+	client.PassCredentialsAll = config.PassCredentialsAll
+
+	return runPull(client, s.Chart.Repository, destDir, s.Chart, s.Options.Cache)
+}
+
+func (s *RepositorySource) String() string {
+	return fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(s.Chart.Registry, "/"), s.Chart.Repository, s.Chart.Version)
+}
+
+func (s *OCISource) Fetch(destDir string) (string, error) {
+	if chartDir, ok, err := fromCache(s.Chart, destDir, s.Options.Cache); ok || err != nil {
+		return chartDir, err
+	}
+
+	client, err := newPullAction(destDir, s.Chart.Version)
+	if err != nil {
+		return "", err
+	}
+
+	registryClient, err := newRegistryClient(client.Settings, s.Chart, s.Options.Registries.For(s.Chart.Registry))
+	if err != nil {
+		return "", fmt.Errorf("failed to create registry client for %s: %w", s.Chart.Registry, err)
+	}
+	client.SetRegistryClient(registryClient)
+
+	return runPull(client, ociReference(s.Chart), destDir, s.Chart, s.Options.Cache)
+}
+
+func (s *OCISource) String() string {
+	return fmt.Sprintf("%s:%s", ociReference(s.Chart), s.Chart.Version)
+}
+
+func (s *DirectorySource) Fetch(_ string) (string, error) {
+	if _, err := os.Stat(filepath.Join(s.Path, "Chart.yaml")); err != nil {
+		return "", fmt.Errorf("%s is not a chart directory: %w", s.Path, err)
+	}
+	return s.Path, nil
+}
+
+func (s *DirectorySource) String() string {
+	return s.Path
+}
+
+func (s *ArchiveSource) Fetch(destDir string) (string, error) {
+	chart, err := loader.Load(s.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to load chart archive %s: %w", s.Path, err)
+	}
+
+	if err := chartutil.ExpandFile(destDir, s.Path); err != nil {
+		return "", fmt.Errorf("failed to extract chart archive %s: %w", s.Path, err)
+	}
+	return filepath.Join(destDir, chart.Name()), nil
+}
+
+func (s *ArchiveSource) String() string {
+	return s.Path
+}
+
+// newPullAction prepares a helm pull that extracts the given version in destDir
+func newPullAction(destDir string, version string) (*action.Pull, error) {
+	settings := cli.New()
+
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(settings.RESTClientGetter(), "default", os.Getenv("HELM_DRIVER"), log.Logger.Debug().Msgf); err != nil {
+		return nil, err
+	}
+
+	client := action.NewPullWithOpts(action.WithConfig(actionConfig))
+	client.DestDir = destDir
+	client.Version = version
+	client.Untar = true
+	client.Settings = settings
+
+	return client, nil
+}
+
+// fromCache extracts the chart in destDir if it is cached, returning true on a cache hit.
+// In offline mode a cache miss is an error
+func fromCache(chart apis.Chart, destDir string, cache *Cache) (string, bool, error) {
+	if cache == nil {
+		return "", false, nil
+	}
+
+	hit, err := cache.Expand(chart, destDir)
+	if err != nil {
+		return "", false, err
+	}
+	if hit {
+		log.Debug().Msgf("%s/%s:%s: found in cache", chart.Registry, chart.Repository, chart.Version)
+		return filepath.Join(destDir, chart.Repository), true, nil
+	}
+	if cache.Offline {
+		return "", false, fmt.Errorf("%s/%s:%s not found in cache and offline mode is enabled", chart.Registry, chart.Repository, chart.Version)
+	}
+	return "", false, nil
+}
+
+// runPull pulls the chart and extracts it in destDir. With a cache, the archive is downloaded
+// in a temporary directory and stored in the cache before being extracted
+func runPull(client *action.Pull, chartRef string, destDir string, chart apis.Chart, cache *Cache) (string, error) {
+	chartDir := filepath.Join(destDir, chart.Repository)
+
+	if cache == nil {
+		result, err := client.Run(chartRef)
+		if err != nil {
+			return "", err
+		}
+
+		log.Debug().Msgf("%s/%s: helm pull result: %s", chart.Registry, chart.Repository, result)
+		return chartDir, nil
+	}
+
+	downloadDir, err := os.MkdirTemp("", "chart-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(downloadDir)
+
+	client.Untar = false
+	client.DestDir = downloadDir
+	result, err := client.Run(chartRef)
+	if err != nil {
+		return "", err
+	}
+	log.Debug().Msgf("%s/%s: helm pull result: %s", chart.Registry, chart.Repository, result)
+
+	archives, err := filepath.Glob(filepath.Join(downloadDir, "*.tgz"))
+	if err != nil || len(archives) != 1 {
+		return "", fmt.Errorf("%s/%s: expected one chart archive in %s, found %d", chart.Registry, chart.Repository, downloadDir, len(archives))
+	}
+
+	if err := cache.Put(chart, archives[0]); err != nil {
+		log.Warn().Err(err).Msgf("%s/%s: could not store chart in cache", chart.Registry, chart.Repository)
+	}
+
+	if err := chartutil.ExpandFile(destDir, archives[0]); err != nil {
+		return "", fmt.Errorf("failed to extract chart archive %s: %w", archives[0], err)
+	}
+	return chartDir, nil
+}
@@ -0,0 +1,181 @@
+package helm
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/repo"
+
+	"installer-release-parser/apis"
+)
+
+// VersionLister is implemented by the sources that can list the published versions of their chart
+type VersionLister interface {
+	Versions() ([]string, error)
+}
+
+// ListVersions returns the published versions of the chart, from the index of its Helm repository or the tags of its OCI registry
+func ListVersions(chart apis.Chart, opts Options) ([]string, error) {
+	lister, ok := NewChartSource(chart, opts).(VersionLister)
+	if !ok {
+		return nil, fmt.Errorf("cannot list the versions of %s", chart.Registry)
+	}
+	return lister.Versions()
+}
+
+func (s *RepositorySource) Versions() ([]string, error) {
+	config := s.Options.Registries.For(s.Chart.Registry)
+
+	cacheDir, err := os.MkdirTemp("", "index-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(cacheDir)
+
+	chartRepository, err := repo.NewChartRepository(&repo.Entry{
+		Name:                  "installer",
+		URL:                   s.Chart.Registry,
+		Username:              config.Username,
+		Password:              config.Password,
+		CertFile:              config.CertFile,
+		KeyFile:               config.KeyFile,
+		CAFile:                config.CAFile,
+		InsecureSkipTLSverify: config.InsecureSkipTLSVerify,
+		PassCredentialsAll:    config.PassCredentialsAll,
+	}, getter.All(cli.New()))
+	if err != nil {
+		return nil, err
+	}
+	chartRepository.CachePath = cacheDir
+
+	indexPath, err := chartRepository.DownloadIndexFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to download index of %s: %w", s.Chart.Registry, err)
+	}
+	index, err := repo.LoadIndexFile(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index of %s: %w", s.Chart.Registry, err)
+	}
+
+	versions := []string{}
+	for _, version := range index.Entries[s.Chart.Repository] {
+		versions = append(versions, version.Version)
+	}
+	return versions, nil
+}
+
+func (s *OCISource) Versions() ([]string, error) {
+	registryClient, err := newRegistryClient(cli.New(), s.Chart, s.Options.Registries.For(s.Chart.Registry))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry client for %s: %w", s.Chart.Registry, err)
+	}
+
+	tags, err := registryClient.Tags(strings.TrimPrefix(ociReference(s.Chart), "oci://"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of %s: %w", ociReference(s.Chart), err)
+	}
+	return tags, nil
+}
+
+// SortVersions returns the semver versions in ascending order, skipping the others and, unless includePrereleases, the pre-releases
+func SortVersions(versions []string, includePrereleases bool) []string {
+	parsed := []*semver.Version{}
+	for _, version := range versions {
+		v, err := semver.NewVersion(version)
+		if err != nil || (v.Prerelease() != "" && !includePrereleases) {
+			continue
+		}
+		parsed = append(parsed, v)
+	}
+	slices.SortFunc(parsed, func(a, b *semver.Version) int {
+		return a.Compare(b)
+	})
+
+	result := []string{}
+	for _, v := range parsed {
+		result = append(result, v.Original())
+	}
+	return result
+}
+
+// ResolvePreviousVersion validates the range previous ... current against the published versions and returns the previous version.
+// When previous is empty, the published version immediately preceding current is chosen (pre-releases only if includePrereleases).
+// If requireCurrent is false, current does not need to be published (e.g., a local chart)
+func ResolvePreviousVersion(current string, previous string, published []string, requireCurrent bool, includePrereleases bool) (string, error) {
+	currentVersion, err := semver.NewVersion(current)
+	if err != nil {
+		return "", fmt.Errorf("current version %s is not a semantic version: %w", current, err)
+	}
+
+	if requireCurrent && !containsVersion(published, currentVersion) {
+		return "", fmt.Errorf("current version %s is not published", current)
+	}
+
+	if previous == "" {
+		candidates := SortVersions(published, includePrereleases)
+		for i := len(candidates) - 1; i >= 0; i-- {
+			if semver.MustParse(candidates[i]).LessThan(currentVersion) {
+				return candidates[i], nil
+			}
+		}
+		return "", fmt.Errorf("no published version precedes %s", current)
+	}
+
+	if err := ValidateRange(previous, current); err != nil {
+		return "", err
+	}
+	if !containsVersion(published, semver.MustParse(previous)) {
+		return "", fmt.Errorf("previous version %s is not published", previous)
+	}
+	return previous, nil
+}
+
+// ValidateRange checks that previous and current are semantic versions and that previous is smaller than current,
+// without looking at the published versions
+func ValidateRange(previous string, current string) error {
+	currentVersion, err := semver.NewVersion(current)
+	if err != nil {
+		return fmt.Errorf("current version %s is not a semantic version: %w", current, err)
+	}
+	previousVersion, err := semver.NewVersion(previous)
+	if err != nil {
+		return fmt.Errorf("previous version %s is not a semantic version: %w", previous, err)
+	}
+	if !previousVersion.LessThan(currentVersion) {
+		return fmt.Errorf("previous version %s must be smaller than current version %s", previous, current)
+	}
+	return nil
+}
+
+func containsVersion(versions []string, version *semver.Version) bool {
+	return slices.ContainsFunc(versions, func(v string) bool {
+		parsed, err := semver.NewVersion(v)
+		return err == nil && parsed.Equal(version)
+	})
+}
+
+// RangeVersions validates the range from ... to against the published versions and returns, in ascending order, the versions from from to to included.
+// When from is empty, the published version immediately preceding to is used, as in ResolvePreviousVersion.
+// Pre-releases between the two are only returned if includePrereleases. If requireTo is false, to does not need to be published (e.g., a local chart)
+func RangeVersions(from string, to string, published []string, requireTo bool, includePrereleases bool) ([]string, error) {
+	from, err := ResolvePreviousVersion(to, from, published, requireTo, includePrereleases)
+	if err != nil {
+		return nil, err
+	}
+	fromVersion := semver.MustParse(from)
+	toVersion := semver.MustParse(to)
+
+	result := []string{from}
+	for _, version := range SortVersions(published, includePrereleases) {
+		v := semver.MustParse(version)
+		if v.GreaterThan(fromVersion) && v.LessThan(toVersion) {
+			result = append(result, version)
+		}
+	}
+	return append(result, to), nil
+}
@@ -0,0 +1,287 @@
+package helm
+
+import (
+	"slices"
+	"testing"
+)
+
+var testPublished = []string{"2.4.0", "2.4.1", "2.5.0-rc.1", "2.5.0", "2.5.1", "2.6.0-rc.1", "2.6.0-rc.2", "not-a-version", "2.6.0"}
+
+func TestSortVersions(t *testing.T) {
+	tests := []struct {
+		name               string
+		versions           []string
+		includePrereleases bool
+		want               []string
+	}{
+		{
+			name:     "without pre-releases",
+			versions: testPublished,
+			want:     []string{"2.4.0", "2.4.1", "2.5.0", "2.5.1", "2.6.0"},
+		},
+		{
+			name:               "with pre-releases",
+			versions:           testPublished,
+			includePrereleases: true,
+			want:               []string{"2.4.0", "2.4.1", "2.5.0-rc.1", "2.5.0", "2.5.1", "2.6.0-rc.1", "2.6.0-rc.2", "2.6.0"},
+		},
+		{
+			name:     "unsorted with v prefix",
+			versions: []string{"v1.10.0", "1.2.0", "v1.9.0"},
+			want:     []string{"1.2.0", "v1.9.0", "v1.10.0"},
+		},
+		{
+			name:     "empty",
+			versions: nil,
+			want:     []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SortVersions(test.versions, test.includePrereleases); !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolvePreviousVersion(t *testing.T) {
+	tests := []struct {
+		name               string
+		current            string
+		previous           string
+		published          []string
+		requireCurrent     bool
+		includePrereleases bool
+		want               string
+		wantErr            bool
+	}{
+		{
+			name:           "previous omitted",
+			current:        "2.6.0",
+			published:      testPublished,
+			requireCurrent: true,
+			want:           "2.5.1",
+		},
+		{
+			name:           "previous omitted skips pre-releases",
+			current:        "2.6.0-rc.2",
+			published:      testPublished,
+			requireCurrent: false,
+			want:           "2.5.1",
+		},
+		{
+			name:               "previous omitted with pre-releases",
+			current:            "2.6.0",
+			published:          testPublished,
+			requireCurrent:     true,
+			includePrereleases: true,
+			want:               "2.6.0-rc.2",
+		},
+		{
+			name:           "previous omitted and none published before current",
+			current:        "2.4.0",
+			published:      testPublished,
+			requireCurrent: true,
+			wantErr:        true,
+		},
+		{
+			name:           "previous published",
+			current:        "2.6.0",
+			previous:       "2.4.1",
+			published:      testPublished,
+			requireCurrent: true,
+			want:           "2.4.1",
+		},
+		{
+			name:           "previous not published",
+			current:        "2.6.0",
+			previous:       "2.4.2",
+			published:      testPublished,
+			requireCurrent: true,
+			wantErr:        true,
+		},
+		{
+			name:           "previous equal to current",
+			current:        "2.5.0",
+			previous:       "2.5.0",
+			published:      testPublished,
+			requireCurrent: true,
+			wantErr:        true,
+		},
+		{
+			name:           "previous greater than current",
+			current:        "2.5.0",
+			previous:       "2.6.0",
+			published:      testPublished,
+			requireCurrent: true,
+			wantErr:        true,
+		},
+		{
+			name:           "previous not semver",
+			current:        "2.5.0",
+			previous:       "latest",
+			published:      testPublished,
+			requireCurrent: true,
+			wantErr:        true,
+		},
+		{
+			name:           "current not semver",
+			current:        "main",
+			published:      testPublished,
+			requireCurrent: false,
+			wantErr:        true,
+		},
+		{
+			name:           "current unpublished",
+			current:        "2.7.0",
+			published:      testPublished,
+			requireCurrent: true,
+			wantErr:        true,
+		},
+		{
+			name:           "current unpublished with a local chart",
+			current:        "2.7.0",
+			published:      testPublished,
+			requireCurrent: false,
+			want:           "2.6.0",
+		},
+		{
+			name:           "current unpublished with a local chart and previous",
+			current:        "2.7.0",
+			previous:       "2.5.0",
+			published:      testPublished,
+			requireCurrent: false,
+			want:           "2.5.0",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolvePreviousVersion(test.current, test.previous, test.published, test.requireCurrent, test.includePrereleases)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRangeVersions(t *testing.T) {
+	tests := []struct {
+		name               string
+		from               string
+		to                 string
+		requireTo          bool
+		includePrereleases bool
+		want               []string
+		wantErr            bool
+	}{
+		{
+			name:      "range",
+			from:      "2.4.1",
+			to:        "2.6.0",
+			requireTo: true,
+			want:      []string{"2.4.1", "2.5.0", "2.5.1", "2.6.0"},
+		},
+		{
+			name:               "range with pre-releases",
+			from:               "2.4.1",
+			to:                 "2.6.0",
+			requireTo:          true,
+			includePrereleases: true,
+			want:               []string{"2.4.1", "2.5.0-rc.1", "2.5.0", "2.5.1", "2.6.0-rc.1", "2.6.0-rc.2", "2.6.0"},
+		},
+		{
+			name:      "from omitted",
+			to:        "2.6.0",
+			requireTo: true,
+			want:      []string{"2.5.1", "2.6.0"},
+		},
+		{
+			name:      "consecutive versions",
+			from:      "2.5.0",
+			to:        "2.5.1",
+			requireTo: true,
+			want:      []string{"2.5.0", "2.5.1"},
+		},
+		{
+			name:      "to unpublished with a local chart",
+			from:      "2.5.1",
+			to:        "2.7.0",
+			requireTo: false,
+			want:      []string{"2.5.1", "2.6.0", "2.7.0"},
+		},
+		{
+			name:      "to unpublished",
+			from:      "2.5.1",
+			to:        "2.7.0",
+			requireTo: true,
+			wantErr:   true,
+		},
+		{
+			name:      "from greater than to",
+			from:      "2.6.0",
+			to:        "2.5.0",
+			requireTo: true,
+			wantErr:   true,
+		},
+		{
+			name:      "from not published",
+			from:      "2.4.2",
+			to:        "2.6.0",
+			requireTo: true,
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := RangeVersions(test.from, test.to, testPublished, test.requireTo, test.includePrereleases)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateRange(t *testing.T) {
+	tests := []struct {
+		previous string
+		current  string
+		wantErr  bool
+	}{
+		{previous: "2.5.0", current: "2.6.0"},
+		{previous: "2.6.0-rc.1", current: "2.6.0"},
+		{previous: "v2.5.0", current: "2.5.1"},
+		{previous: "2.6.0", current: "2.6.0", wantErr: true},
+		{previous: "2.6.0", current: "2.5.0", wantErr: true},
+		{previous: "latest", current: "2.5.0", wantErr: true},
+		{previous: "2.5.0", current: "main", wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := ValidateRange(test.previous, test.current)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s ... %s: got error %v, want error %t", test.previous, test.current, err, test.wantErr)
+		}
+	}
+}
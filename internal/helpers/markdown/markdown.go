@@ -0,0 +1,104 @@
+package markdown
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"installer-release-parser/internal/helpers/diff"
+)
+
+// RemovedCharts lists the removed components and the previous version of the moved ones
+func RemovedCharts(changes diff.ChangeSet) string {
+	sb := strings.Builder{}
+	sb.WriteString("## Removed Charts\n")
+
+	removed := slices.Concat(changes.Removed, changes.Moved)
+	if len(removed) == 0 {
+		sb.WriteString("Nothing removed\n")
+		return sb.String()
+	}
+
+	for _, change := range removed {
+		sb.WriteString(fmt.Sprintf("- %s v%s: Removed\n", change.Previous.ImageName, change.Previous.AppVersion))
+	}
+	return sb.String()
+}
+
+// NewCharts lists the components added in the current version with their chart and repository.
+// fullNames holds the owner/repository of each component, by key, when known
+func NewCharts(changes diff.ChangeSet, fullNames map[string]string) string {
+	sb := strings.Builder{}
+	sb.WriteString("## New Charts\n")
+
+	if len(changes.Added) == 0 {
+		sb.WriteString("Nothing added\n")
+		return sb.String()
+	}
+
+	for _, change := range changes.Added {
+		chart := change.Current
+		sb.WriteString(fmt.Sprintf("- %s v%s: chart %s %s from %s", chart.ImageName, chart.AppVersion, chart.Repository, chart.Version, chart.Registry))
+		if fullName, ok := fullNames[change.Key]; ok {
+			sb.WriteString(fmt.Sprintf(" ([repository](https://github.com/%s))", fullName))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// DowngradedCharts warns about the components whose version decreased, empty if there are none
+func DowngradedCharts(changes diff.ChangeSet) string {
+	if len(changes.Downgraded) == 0 {
+		return ""
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString("## ⚠️ Downgraded Charts\n")
+	sb.WriteString("The following components have a lower version than in the previous release:\n")
+	for _, change := range changes.Downgraded {
+		sb.WriteString(fmt.Sprintf("- **%s v%s → v%s**\n", change.Current.ImageName, change.Previous.AppVersion, change.Current.AppVersion))
+	}
+	return sb.String()
+}
+
+// UnchangedCharts lists the components with the same version as in the previous release
+func UnchangedCharts(changes diff.ChangeSet) string {
+	sb := strings.Builder{}
+	sb.WriteString("## Unchanged Charts\n")
+
+	if len(changes.Unchanged) == 0 {
+		sb.WriteString("Nothing unchanged\n")
+		return sb.String()
+	}
+
+	for _, change := range changes.Unchanged {
+		sb.WriteString(fmt.Sprintf("- %s v%s\n", change.Current.ImageName, change.Current.AppVersion))
+	}
+	return sb.String()
+}
+
+// Summary lists every changed component once, with its version at the start and at the end of the changes
+func Summary(changes diff.ChangeSet) string {
+	sb := strings.Builder{}
+	sb.WriteString("## Summary\n")
+
+	if len(changes.Added)+len(changes.Removed)+len(changes.Upgraded)+len(changes.Downgraded)+len(changes.Moved) == 0 {
+		sb.WriteString("Nothing changed\n")
+		return sb.String()
+	}
+
+	for _, change := range changes.Added {
+		sb.WriteString(fmt.Sprintf("- %s v%s: Added\n", change.Current.ImageName, change.Current.AppVersion))
+	}
+	for _, change := range slices.Concat(changes.Upgraded, changes.Downgraded) {
+		sb.WriteString(fmt.Sprintf("- %s v%s → v%s\n", change.Current.ImageName, change.Previous.AppVersion, change.Current.AppVersion))
+	}
+	for _, change := range changes.Moved {
+		sb.WriteString(fmt.Sprintf("- %s v%s → %s v%s: Moved\n", change.Previous.ImageName, change.Previous.AppVersion, change.Current.ImageName, change.Current.AppVersion))
+	}
+	for _, change := range changes.Removed {
+		sb.WriteString(fmt.Sprintf("- %s v%s: Removed\n", change.Previous.ImageName, change.Previous.AppVersion))
+	}
+	return sb.String()
+}
@@ -0,0 +1,114 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+var releaseHeader = regexp.MustCompile(`^# Release (\S+)\s*$`)
+
+// ReleaseNotesFile is the content of RELEASE_NOTES.md, split in one section per installer version
+type ReleaseNotesFile struct {
+	// Text preceding the first section, kept as is
+	Preamble string
+	// Sections sorted by version, latest first
+	Sections []ReleaseSection
+}
+
+// ReleaseSection is the release notes of an installer version, without the "# Release <version>" header
+type ReleaseSection struct {
+	Version string
+	Notes   string
+}
+
+// ParseReleaseNotesFile splits the content in sections, each starting with a "# Release <version>" line.
+// The "<br><br>" separators and the blank lines around the notes are dropped
+func ParseReleaseNotesFile(content string) ReleaseNotesFile {
+	file := ReleaseNotesFile{}
+	var current *ReleaseSection
+	body := []string{}
+
+	flush := func() {
+		if current == nil {
+			file.Preamble = strings.Join(body, "\n")
+			return
+		}
+		notes := strings.TrimSpace(strings.Join(body, "\n"))
+		notes = strings.TrimSpace(strings.TrimSuffix(notes, "<br><br>"))
+		current.Notes = notes
+		file.Sections = append(file.Sections, *current)
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if matches := releaseHeader.FindStringSubmatch(line); matches != nil {
+			flush()
+			current = &ReleaseSection{Version: matches[1]}
+			body = []string{}
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+
+	return file
+}
+
+// Set replaces the sections of the version with the given notes, or adds one, and sorts the sections.
+// Versions are matched semantically (e.g., v2.5.1 is 2.5.1), the replaced sections take the given version.
+// It returns false if the file already had a single section of the version with the same notes at the right position
+func (f *ReleaseNotesFile) Set(version string, notes string) bool {
+	notes = strings.TrimSpace(notes)
+	before := slices.Clone(f.Sections)
+
+	f.Sections = slices.DeleteFunc(f.Sections, func(section ReleaseSection) bool {
+		return sameVersion(section.Version, version)
+	})
+	f.Sections = append(f.Sections, ReleaseSection{Version: version, Notes: notes})
+	f.sort()
+
+	return !slices.Equal(before, f.Sections)
+}
+
+// sameVersion tells whether two versions are equal semantically, or as strings if one of them is not semver
+func sameVersion(a string, b string) bool {
+	versionA, errA := semver.NewVersion(a)
+	versionB, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return versionA.Equal(versionB)
+}
+
+// sort orders the sections by semantic version, latest first. Sections without a semantic version keep their order at the end
+func (f *ReleaseNotesFile) sort() {
+	slices.SortStableFunc(f.Sections, func(a, b ReleaseSection) int {
+		va, errA := semver.NewVersion(a.Version)
+		vb, errB := semver.NewVersion(b.Version)
+		switch {
+		case errA != nil && errB != nil:
+			return 0
+		case errA != nil:
+			return 1
+		case errB != nil:
+			return -1
+		}
+		return vb.Compare(va)
+	})
+}
+
+func (f ReleaseNotesFile) String() string {
+	sections := []string{}
+	for _, section := range f.Sections {
+		sections = append(sections, fmt.Sprintf("# Release %s\n\n%s\n", section.Version, section.Notes))
+	}
+
+	content := strings.Join(sections, "\n<br><br>\n\n")
+	if strings.TrimSpace(f.Preamble) != "" {
+		content = strings.TrimRight(f.Preamble, "\n") + "\n\n" + content
+	}
+	return content
+}
@@ -0,0 +1,232 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReleaseNotesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    ReleaseNotesFile
+	}{
+		{
+			name:    "empty",
+			content: "",
+			want:    ReleaseNotesFile{},
+		},
+		{
+			// Sections prepended by the earlier versions, separated by a <br><br> line right after the notes
+			name:    "prepend format",
+			content: "# Release 2.5.1\n\n## core v1.1.0\n### What's Changed\n* fix\n\n<br><br>\n# Release 2.5.0\n\n## core v1.0.0\n### What's Changed\n* first\n\n",
+			want: ReleaseNotesFile{
+				Sections: []ReleaseSection{
+					{Version: "2.5.1", Notes: "## core v1.1.0\n### What's Changed\n* fix"},
+					{Version: "2.5.0", Notes: "## core v1.0.0\n### What's Changed\n* first"},
+				},
+			},
+		},
+		{
+			name:    "current format",
+			content: "# Release 2.5.1\n\n* fix\n\n<br><br>\n\n# Release 2.5.0\n\n* first\n",
+			want: ReleaseNotesFile{
+				Sections: []ReleaseSection{
+					{Version: "2.5.1", Notes: "* fix"},
+					{Version: "2.5.0", Notes: "* first"},
+				},
+			},
+		},
+		{
+			name:    "preamble",
+			content: "# Krateo Release Notes\n\nSee the releases page.\n\n# Release 2.5.0\n\n* first\n",
+			want: ReleaseNotesFile{
+				Preamble: "# Krateo Release Notes\n\nSee the releases page.\n",
+				Sections: []ReleaseSection{
+					{Version: "2.5.0", Notes: "* first"},
+				},
+			},
+		},
+		{
+			name:    "duplicate sections",
+			content: "# Release 2.5.0\n\n* second run\n<br><br>\n# Release 2.5.0\n\n* first run\n",
+			want: ReleaseNotesFile{
+				Sections: []ReleaseSection{
+					{Version: "2.5.0", Notes: "* second run"},
+					{Version: "2.5.0", Notes: "* first run"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ParseReleaseNotesFile(test.content)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		version string
+		notes   string
+		changed bool
+		want    []ReleaseSection
+	}{
+		{
+			name:    "empty file",
+			content: "",
+			version: "2.5.0",
+			notes:   "* first\n",
+			changed: true,
+			want:    []ReleaseSection{{Version: "2.5.0", Notes: "* first"}},
+		},
+		{
+			name:    "new latest version",
+			content: "# Release 2.5.0\n\n* first\n",
+			version: "2.5.1",
+			notes:   "* fix",
+			changed: true,
+			want: []ReleaseSection{
+				{Version: "2.5.1", Notes: "* fix"},
+				{Version: "2.5.0", Notes: "* first"},
+			},
+		},
+		{
+			name:    "older version sorted",
+			content: "# Release 2.6.0\n\n* feature\n<br><br>\n# Release 2.4.0\n\n* old\n",
+			version: "2.5.0",
+			notes:   "* middle",
+			changed: true,
+			want: []ReleaseSection{
+				{Version: "2.6.0", Notes: "* feature"},
+				{Version: "2.5.0", Notes: "* middle"},
+				{Version: "2.4.0", Notes: "* old"},
+			},
+		},
+		{
+			name:    "existing version replaced",
+			content: "# Release 2.5.1\n\n* old notes\n<br><br>\n# Release 2.5.0\n\n* first\n",
+			version: "2.5.1",
+			notes:   "* new notes",
+			changed: true,
+			want: []ReleaseSection{
+				{Version: "2.5.1", Notes: "* new notes"},
+				{Version: "2.5.0", Notes: "* first"},
+			},
+		},
+		{
+			name:    "duplicate sections merged",
+			content: "# Release 2.5.0\n\n* second run\n<br><br>\n# Release 2.5.0\n\n* first run\n",
+			version: "2.5.0",
+			notes:   "* third run",
+			changed: true,
+			want:    []ReleaseSection{{Version: "2.5.0", Notes: "* third run"}},
+		},
+		{
+			name:    "duplicate sections with the same notes",
+			content: "# Release 2.5.0\n\n* notes\n<br><br>\n# Release 2.5.0\n\n* notes\n",
+			version: "2.5.0",
+			notes:   "* notes",
+			changed: true,
+			want:    []ReleaseSection{{Version: "2.5.0", Notes: "* notes"}},
+		},
+		{
+			name:    "v prefix matched semantically",
+			content: "# Release v2.5.1\n\n* old notes\n<br><br>\n# Release 2.5.0\n\n* first\n",
+			version: "2.5.1",
+			notes:   "* new notes",
+			changed: true,
+			want: []ReleaseSection{
+				{Version: "2.5.1", Notes: "* new notes"},
+				{Version: "2.5.0", Notes: "* first"},
+			},
+		},
+		{
+			name:    "non-semver version matched as string",
+			content: "# Release nightly\n\n* old\n<br><br>\n# Release 2.5.0\n\n* first\n",
+			version: "nightly",
+			notes:   "* new",
+			changed: true,
+			want: []ReleaseSection{
+				{Version: "2.5.0", Notes: "* first"},
+				{Version: "nightly", Notes: "* new"},
+			},
+		},
+		{
+			name:    "rerun without changes",
+			content: "# Release 2.5.1\n\n* fix\n\n<br><br>\n\n# Release 2.5.0\n\n* first\n",
+			version: "2.5.1",
+			notes:   "* fix\n\n",
+			changed: false,
+			want: []ReleaseSection{
+				{Version: "2.5.1", Notes: "* fix"},
+				{Version: "2.5.0", Notes: "* first"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := ParseReleaseNotesFile(test.content)
+			if changed := file.Set(test.version, test.notes); changed != test.changed {
+				t.Errorf("got changed %t, want %t", changed, test.changed)
+			}
+			if !reflect.DeepEqual(file.Sections, test.want) {
+				t.Errorf("got %+v, want %+v", file.Sections, test.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	file := ReleaseNotesFile{
+		Preamble: "# Krateo Release Notes\n\n",
+		Sections: []ReleaseSection{
+			{Version: "2.5.1", Notes: "* fix"},
+			{Version: "2.5.0", Notes: "* first"},
+		},
+	}
+	want := "# Krateo Release Notes\n\n# Release 2.5.1\n\n* fix\n\n<br><br>\n\n# Release 2.5.0\n\n* first\n"
+	if got := file.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Parsing the output gives back the same file, so that reruns find nothing to change
+	parsed := ParseReleaseNotesFile(file.String())
+	if strings.TrimSpace(parsed.Preamble) != strings.TrimSpace(file.Preamble) || !reflect.DeepEqual(parsed.Sections, file.Sections) {
+		t.Errorf("got %+v after parsing, want %+v", parsed, file)
+	}
+	for _, section := range file.Sections {
+		if parsed.Set(section.Version, section.Notes) {
+			t.Errorf("%s: Set reported a change on the parsed file", section.Version)
+		}
+	}
+	if parsed.String() != want {
+		t.Errorf("got %q after a rerun, want %q", parsed.String(), want)
+	}
+}
+
+func TestStringPrependFormatRewritten(t *testing.T) {
+	// A file in the prepend format is rewritten once in the current format, then left as is
+	content := "# Release 2.5.1\n\n* fix\n\n<br><br>\n# Release 2.5.0\n\n* first\n\n"
+	file := ParseReleaseNotesFile(content)
+	if !file.Set("2.6.0", "* feature") {
+		t.Fatal("got no change for a new version")
+	}
+	want := "# Release 2.6.0\n\n* feature\n\n<br><br>\n\n# Release 2.5.1\n\n* fix\n\n<br><br>\n\n# Release 2.5.0\n\n* first\n"
+	if got := file.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	rerun := ParseReleaseNotesFile(file.String())
+	if rerun.Set("2.6.0", "* feature") {
+		t.Error("got a change on rerun")
+	}
+}
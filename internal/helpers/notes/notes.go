@@ -0,0 +1,225 @@
+package notes
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"installer-release-parser/apis"
+	"installer-release-parser/internal/helpers/configuration"
+	"installer-release-parser/internal/helpers/diff"
+	"installer-release-parser/internal/helpers/github"
+	"installer-release-parser/internal/helpers/helm"
+	"installer-release-parser/internal/helpers/markdown"
+	"installer-release-parser/internal/helpers/workspace"
+)
+
+// Generator pulls installer versions and generates the release notes between them.
+// Each installer version is pulled and parsed at most once per run
+type Generator struct {
+	Config    configuration.Configuration
+	Clients   *github.ClientPool
+	Options   helm.Options
+	Workspace *workspace.Workspace
+	// Organizations of the component repositories, shared by all the installer versions of the run
+	resolver *github.Resolver
+	// Components of the parsed installer versions, by version
+	parsed map[string]map[string]apis.Repoes
+	// Components that could not be read, by version
+	skipped map[string][]*helm.ComponentError
+}
+
+// Hop is the comparison between two installer versions
+type Hop struct {
+	Previous string
+	Current  string
+	Changes  diff.ChangeSet
+	// Markdown release notes of the components changed from Previous to Current
+	ReleaseNotes string
+	// Keys of the components with release notes
+	Succeeded []string
+	// Components missing from the release notes or from the comparison
+	Failures []Failure
+}
+
+// Failure is a component that could not be read or whose release notes could not be generated
+type Failure struct {
+	// Installer version of the component
+	Version string
+	// Component key, empty if the whole installer version failed
+	Key string
+	Err error
+}
+
+func NewGenerator(config configuration.Configuration, clients *github.ClientPool, opts helm.Options, ws *workspace.Workspace) *Generator {
+	return &Generator{
+		Config:    config,
+		Clients:   clients,
+		Options:   opts,
+		Workspace: ws,
+		resolver:  github.NewResolver(clients, config.Organizations),
+		parsed:    map[string]map[string]apis.Repoes{},
+		skipped:   map[string][]*helm.ComponentError{},
+	}
+}
+
+// Components pulls the installer chart at the given version and all the charts listed in it.
+// The current installer version is read from the local installer chart path when set
+func (g *Generator) Components(version string) (map[string]apis.Repoes, error) {
+	if components, ok := g.parsed[version]; ok {
+		return components, nil
+	}
+
+	installerSource := helm.NewChartSource(apis.Chart{
+		Registry:   g.Config.InstallerChartRegistry,
+		Repository: g.Config.InstallerChartRepository,
+		Version:    version,
+	}, g.Options)
+	if version == g.Config.InstallerChartVersion && g.Config.InstallerChartPath != "" {
+		localSource, err := helm.NewLocalChartSource(g.Config.InstallerChartPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the local installer chart: %w", err)
+		}
+		installerSource = localSource
+	}
+
+	versionDir, err := g.Workspace.VersionDir(version)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Msgf("Downloading installer chart %s from %s...", version, installerSource)
+	installerDir, err := installerSource.Fetch(versionDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull installer chart %s: %w", version, err)
+	}
+
+	// Pull all charts to get the appVersion
+	log.Info().Msg("Downloading all charts...")
+	components, skipped, err := helm.ParseValues(installerDir, versionDir, g.Options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the components of installer chart %s: %w", version, err)
+	}
+	log.Debug().Msgf("=== Installer %s Versions", version)
+	for key := range components {
+		log.Debug().Msgf("%s: %s", key, components[key])
+	}
+
+	g.parsed[version] = components
+	g.skipped[version] = skipped
+	return components, nil
+}
+
+// Compare computes the changes between two installer versions and generates their release notes
+func (g *Generator) Compare(previous string, current string) (Hop, error) {
+	currentComponents, err := g.Components(current)
+	if err != nil {
+		return Hop{}, err
+	}
+	previousComponents, err := g.Components(previous)
+	if err != nil {
+		return Hop{}, err
+	}
+
+	changes := diff.Compare(currentComponents, previousComponents)
+	for _, change := range changes.All() {
+		log.Debug().Msgf("%s %s: %s", change.Type, change.Key, change.Reason)
+	}
+
+	// Call the Github API to get the release notes
+	log.Info().Msgf("Generating release notes for %s ... %s...", previous, current)
+	releaseNotes, fullNames, failures := github.GetReleaseNotes(changes.Range(), g.Clients, g.resolver, g.Options.Repositories)
+	finalReleaseNotes := fmt.Sprintf("%s\n%s\n%s", markdown.NewCharts(changes, fullNames), markdown.RemovedCharts(changes), releaseNotes)
+	if g.Config.ShowUnchanged {
+		finalReleaseNotes = fmt.Sprintf("%s\n%s", finalReleaseNotes, markdown.UnchangedCharts(changes))
+	}
+	if downgraded := markdown.DowngradedCharts(changes); downgraded != "" {
+		finalReleaseNotes = fmt.Sprintf("%s\n%s", downgraded, finalReleaseNotes)
+	}
+
+	hop := Hop{
+		Previous:     previous,
+		Current:      current,
+		Changes:      changes,
+		ReleaseNotes: finalReleaseNotes,
+		Succeeded:    slices.Sorted(maps.Keys(fullNames)),
+	}
+	for _, version := range []string{previous, current} {
+		for _, skipped := range g.skipped[version] {
+			hop.Failures = append(hop.Failures, Failure{Version: version, Key: skipped.Key, Err: skipped.Err})
+		}
+	}
+	for _, failure := range failures {
+		hop.Failures = append(hop.Failures, Failure{Version: current, Key: failure.Key, Err: failure})
+	}
+	return hop, nil
+}
+
+// CompareRange compares every pair of consecutive installer versions, returning the hops in ascending order
+// and the summary of the changes from the first to the last version
+func (g *Generator) CompareRange(versions []string) ([]Hop, diff.ChangeSet, error) {
+	if len(versions) < 2 {
+		return nil, diff.ChangeSet{}, fmt.Errorf("at least two versions are needed, got %d", len(versions))
+	}
+
+	hops := []Hop{}
+	for i := 1; i < len(versions); i++ {
+		hop, err := g.Compare(versions[i-1], versions[i])
+		if err != nil {
+			return nil, diff.ChangeSet{}, err
+		}
+		hops = append(hops, hop)
+	}
+
+	// Components changed in several hops are listed once, from their first to their last version
+	first, err := g.Components(versions[0])
+	if err != nil {
+		return nil, diff.ChangeSet{}, err
+	}
+	last, err := g.Components(versions[len(versions)-1])
+	if err != nil {
+		return nil, diff.ChangeSet{}, err
+	}
+	return hops, diff.Compare(last, first), nil
+}
+
+// RangeReleaseNotes joins the summary of the whole range and the release notes of each hop, latest first
+func RangeReleaseNotes(hops []Hop, summary diff.ChangeSet) string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("# Release %s ... %s\n\n", hops[0].Previous, hops[len(hops)-1].Current))
+	sb.WriteString(markdown.Summary(summary))
+
+	for _, hop := range slices.Backward(hops) {
+		sb.WriteString(fmt.Sprintf("<br><br>\n# Release %s\n\n%s\n", hop.Current, hop.ReleaseNotes))
+	}
+	return sb.String()
+}
+
+// Backfill compares every pair of consecutive installer versions, returning the hops in ascending order.
+// Unlike CompareRange, the hops that cannot be compared are skipped with a warning and returned as failures
+func (g *Generator) Backfill(versions []string) ([]Hop, []Failure) {
+	hops := []Hop{}
+	failures := []Failure{}
+	for i := 1; i < len(versions); i++ {
+		hop, err := g.Compare(versions[i-1], versions[i])
+		if err != nil {
+			log.Warn().Err(err).Msgf("Skipping %s: could not compare it to %s", versions[i], versions[i-1])
+			failures = append(failures, Failure{Version: versions[i], Err: err})
+			continue
+		}
+		hops = append(hops, hop)
+	}
+	return hops, failures
+}
+
+// ReleaseSections returns the sections of RELEASE_NOTES.md regenerated by the hops, one per current version
+func ReleaseSections(hops []Hop) []markdown.ReleaseSection {
+	sections := []markdown.ReleaseSection{}
+	for _, hop := range hops {
+		sections = append(sections, markdown.ReleaseSection{Version: hop.Current, Notes: hop.ReleaseNotes})
+	}
+	return sections
+}
@@ -0,0 +1,49 @@
+package notes
+
+import (
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Summary is the outcome of a run, by component
+type Summary struct {
+	// Components with release notes, as version/key
+	Succeeded []string
+	Failures  []Failure
+}
+
+// Summarize collects the outcome of the hops and of the failures outside of them, each failure is listed once
+func Summarize(hops []Hop, failures ...Failure) Summary {
+	summary := Summary{}
+	for _, hop := range hops {
+		for _, key := range hop.Succeeded {
+			summary.Succeeded = append(summary.Succeeded, hop.Current+"/"+key)
+		}
+		failures = append(failures, hop.Failures...)
+	}
+
+	for _, failure := range failures {
+		if !slices.ContainsFunc(summary.Failures, func(f Failure) bool {
+			return f.Version == failure.Version && f.Key == failure.Key
+		}) {
+			summary.Failures = append(summary.Failures, failure)
+		}
+	}
+	return summary
+}
+
+// Log writes the summary, failures first
+func (s Summary) Log() {
+	log.Info().Msgf("=== Run summary: %d components with release notes, %d failures", len(s.Succeeded), len(s.Failures))
+	for _, failure := range s.Failures {
+		if failure.Key == "" {
+			log.Error().Err(failure.Err).Msgf("%s: failed", failure.Version)
+			continue
+		}
+		log.Error().Err(failure.Err).Msgf("%s %s: failed", failure.Version, failure.Key)
+	}
+	for _, component := range s.Succeeded {
+		log.Info().Msgf("%s: ok", component)
+	}
+}
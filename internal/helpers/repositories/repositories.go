@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Repository is the GitHub repository of a component that does not declare its image
+type Repository struct {
+	Name string `json:"name" yaml:"name"`
+	// Organization hosting the repository, the configured organizations are searched if empty
+	Organization string `json:"organization,omitempty" yaml:"organization,omitempty"`
+}
+
+// Mapping associates the component keys of the installer values to their repositories
+type Mapping map[string]Repository
+
+var (
+	DEFAULT_REPOSITORIES = Mapping{
+		"finopsnotebooks":         {Name: "finops-notebooks-chart"},
+		"composableportalstarter": {Name: "portal"},
+		"composableportalbasic":   {Name: "composable-portal-basic"},
+		"finopspolicies":          {Name: "finops-moving-window-policy-chart"},
+		"crate":                   {Name: "cratedb-chart"},
+		"opa":                     {Name: "opa-chart"},
+	}
+)
+
+// Load reads a YAML or JSON mapping file and merges it over DEFAULT_REPOSITORIES.
+// The file is either a map or a ConfigMap whose data holds the map. Each entry is a
+// repository name, an "organization/name" string or an object with name and organization
+func Load(path string) (Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repositories mapping %s: %w", path, err)
+	}
+
+	var document map[string]any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal repositories mapping %s: %w", path, err)
+	}
+
+	if kind, _ := document["kind"].(string); kind == "ConfigMap" {
+		document, _ = document["data"].(map[string]any)
+	}
+
+	mapping := maps.Clone(DEFAULT_REPOSITORIES)
+	for key, value := range document {
+		repository, err := parseEntry(value)
+		if err != nil {
+			return nil, fmt.Errorf("repositories mapping %s, entry %s: %w", path, key, err)
+		}
+		mapping[key] = repository
+	}
+	return mapping, nil
+}
+
+// Lookup returns the repository of the component key
+func (m Mapping) Lookup(key string) (Repository, bool) {
+	repository, ok := m[key]
+	return repository, ok
+}
+
+func parseEntry(value any) (Repository, error) {
+	switch entry := value.(type) {
+	case string:
+		organization, name, found := strings.Cut(entry, "/")
+		if !found {
+			return Repository{Name: entry}, nil
+		}
+		return Repository{Name: name, Organization: organization}, nil
+	case map[string]any:
+		name, ok := entry["name"].(string)
+		if !ok || name == "" {
+			return Repository{}, fmt.Errorf("name is not a string")
+		}
+		organization, _ := entry["organization"].(string)
+		return Repository{Name: name, Organization: organization}, nil
+	default:
+		return Repository{}, fmt.Errorf("not a string or a map")
+	}
+}
@@ -0,0 +1,69 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Workspace is the temporary directory of a single run, each installer version is extracted in its own sub-directory
+type Workspace struct {
+	Root string
+	keep bool
+	once sync.Once
+}
+
+// New creates the workspace in the system temporary directory (TMPDIR).
+// If keep is true, the workspace is left on disk after the run for debugging
+func New(keep bool) (*Workspace, error) {
+	root, err := os.MkdirTemp("", "installer-release-parser-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	log.Debug().Msgf("Workspace created in %s", root)
+
+	return &Workspace{Root: root, keep: keep}, nil
+}
+
+// VersionDir creates a new, empty directory for the given installer version
+func (w *Workspace) VersionDir(version string) (string, error) {
+	dir, err := os.MkdirTemp(w.Root, version+"-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create workspace directory for version %s: %w", version, err)
+	}
+	return dir, nil
+}
+
+// Cleanup removes the workspace, unless it must be kept. It is safe to call it more than once
+func (w *Workspace) Cleanup() {
+	w.once.Do(func() {
+		if w.keep {
+			log.Info().Msgf("Keeping workspace %s", w.Root)
+			return
+		}
+		if err := os.RemoveAll(w.Root); err != nil {
+			log.Warn().Err(err).Msgf("could not remove workspace %s", w.Root)
+		}
+	})
+}
+
+// CleanupOnSignal removes the workspace and exits when the process is interrupted or terminated.
+// The exit code is 128 plus the signal number, as in shells (130 for SIGINT, 143 for SIGTERM)
+func (w *Workspace) CleanupOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Warn().Msgf("Received %s, cleaning up", sig)
+		w.Cleanup()
+		code := 128 + int(syscall.SIGINT)
+		if number, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(number)
+		}
+		os.Exit(code)
+	}()
+}
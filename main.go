@@ -6,15 +6,38 @@ import (
 	"installer-release-parser/internal/helpers/configuration"
 	"installer-release-parser/internal/helpers/github"
 	"installer-release-parser/internal/helpers/helm"
+	"installer-release-parser/internal/helpers/notes"
+	"installer-release-parser/internal/helpers/repositories"
+	"installer-release-parser/internal/helpers/workspace"
 	"os"
+	"path/filepath"
 	"slices"
-	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// Exit codes of the run. They start from 3, since Go exits with 2 on invalid flags and panics,
+// and the workspace cleanup exits with 128 plus the signal number when interrupted
+const (
+	EXIT_OK = 0
+	// Invalid configuration or installer version range
+	EXIT_CONFIGURATION_ERROR = 3
+	// The installer charts could not be read or the release notes could not be written to file
+	EXIT_GENERATION_ERROR = 4
+	// Some components are missing from the release notes and STRICT is set
+	EXIT_INCOMPLETE = 5
+	// Some components were downgraded and ALLOW_DOWNGRADE is not set
+	EXIT_DOWNGRADE = 6
+	// The GitHub release or RELEASE_NOTES.md could not be published
+	EXIT_PUBLISH_ERROR = 7
+)
+
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 	log.Info().Msg("Starting up")
 
@@ -27,136 +50,304 @@ func main() {
 		log.Debug().Msgf("New list: %s", config.Organizations)
 	}
 
-	// Pull the current installer chart
-	log.Info().Msg("Downloading current installer chart...")
-	err := helm.Pull(apis.Chart{
-		Registry:   config.InstallerChartRegistry,
-		Repository: config.InstallerChartRepository,
-		Version:    config.InstallerChartVersion,
+	if !slices.Contains([]string{"release", "range", "backfill", "promote"}, config.Mode) {
+		log.Error().Msgf("unknown mode %s, must be release, range, backfill or promote", config.Mode)
+		return EXIT_CONFIGURATION_ERROR
+	}
+	if !slices.Contains([]string{"auto", "true", "false"}, config.ReleasePrerelease) {
+		log.Error().Msgf("invalid release prerelease %s, must be auto, true or false", config.ReleasePrerelease)
+		return EXIT_CONFIGURATION_ERROR
+	}
+	if !slices.Contains([]string{"", "true", "false", "legacy"}, config.MakeLatest) {
+		log.Error().Msgf("invalid make latest %s, must be true, false or legacy", config.MakeLatest)
+		return EXIT_CONFIGURATION_ERROR
+	}
+
+	// Each organization uses its own token, the others the default token or anonymous requests
+	// Rate limits and transient failures are retried by the transport
+	transport := github.NewRetryTransport(github.RetryOptions{
+		MaxRetries: config.GithubMaxRetries,
+		MaxWait:    config.GithubMaxWait,
 	})
-	if err != nil {
-		log.Error().Err(err).Msg("there was an error while pulling the current installer chart")
-		cleanup()
-		return
+	clients := github.NewClientPool(config.Tokens, transport)
+	if config.GithubAppID != 0 {
+		app, err := github.NewApp(int64(config.GithubAppID), config.GithubAppPrivateKeyFile, config.GithubAppPrivateKey, transport)
+		if err != nil {
+			log.Error().Err(err).Msg("there was an error while loading the GitHub App")
+			return EXIT_CONFIGURATION_ERROR
+		}
+		if err := clients.UseApp(app, config.InstallerOrganization); err != nil {
+			log.Error().Err(err).Msg("there was an error while authenticating as the GitHub App")
+			return EXIT_CONFIGURATION_ERROR
+		}
 	}
 
-	// Pull all charts to get the appVersion
-	log.Info().Msg("Downloading all charts...")
-	allCharts, err := helm.ParseValues()
-	if err != nil {
-		log.Error().Err(err).Msg("there was an error while parsing all repositories from the installer chart values file")
-		cleanup()
-		return
+	// Promoting a draft release does not need the charts
+	if config.Mode == "promote" {
+		log.Info().Msgf("Publishing draft release on installer repository %s/%s:%s", config.InstallerOrganization, config.InstallerChartGithubRepository, config.InstallerChartVersion)
+		if err := github.PromoteInstallerRelease(clients, config); err != nil {
+			log.Error().Err(err).Msg("there was an error while publishing the draft release")
+			return EXIT_PUBLISH_ERROR
+		}
+		return EXIT_OK
+	}
+
+	pullOptions := helm.Options{
+		Concurrency: config.PullConcurrency,
+		Timeout:     config.PullTimeout,
+	}
+
+	// Registry settings: the registries config file first, then Helm's repositories.yaml, then the REGISTRY_* settings
+	if config.RegistriesConfig != "" {
+		registries, err := helm.LoadRegistries(config.RegistriesConfig)
+		if err != nil {
+			log.Error().Err(err).Msg("there was an error while loading the registries config")
+			return EXIT_CONFIGURATION_ERROR
+		}
+		pullOptions.Registries = registries
+	}
+	pullOptions.Registries = append(pullOptions.Registries, helm.HelmRepositories()...)
+	// Without REGISTRY_URL, the credentials are only sent to the host of the installer chart registry
+	registryURL := config.RegistryURL
+	if registryURL == "" {
+		hostURL, err := helm.RegistryHostURL(config.InstallerChartRegistry)
+		if err != nil {
+			log.Error().Err(err).Msg("REGISTRY_URL is required when the installer chart registry has no host")
+			return EXIT_CONFIGURATION_ERROR
+		}
+		registryURL = hostURL
+	}
+	pullOptions.Registries = append(pullOptions.Registries, helm.RegistryConfig{
+		URL:                   registryURL,
+		Username:              config.RegistryUsername,
+		Password:              config.RegistryToken,
+		CertFile:              config.RegistryCertFile,
+		KeyFile:               config.RegistryKeyFile,
+		CAFile:                config.RegistryCAFile,
+		InsecureSkipTLSVerify: config.RegistryInsecureSkipTLSVerify,
+		PlainHTTP:             config.RegistryPlainHTTP,
+	})
+
+	if config.ValuesSchema != "" {
+		schema, err := helm.LoadSchema(config.ValuesSchema)
+		if err != nil {
+			log.Error().Err(err).Msg("there was an error while loading the values schema")
+			return EXIT_CONFIGURATION_ERROR
+		}
+		pullOptions.Schema = schema
 	}
-	log.Debug().Msg("=== Current Installer Versions")
-	for key := range allCharts {
-		log.Debug().Msgf("%s: %s", key, allCharts[key])
+
+	pullOptions.Repositories = repositories.DEFAULT_REPOSITORIES
+	if config.RepositoriesMapping != "" {
+		mapping, err := repositories.Load(config.RepositoriesMapping)
+		if err != nil {
+			log.Error().Err(err).Msg("there was an error while loading the repositories mapping")
+			return EXIT_CONFIGURATION_ERROR
+		}
+		pullOptions.Repositories = mapping
 	}
 
-	// Remove current release
-	cleanup()
+	if config.ChartCache {
+		cache, err := helm.NewCache(config.ChartCacheDir, int64(config.ChartCacheMaxSize)*1024*1024, config.Offline)
+		if err != nil {
+			log.Warn().Err(err).Msg("could not create chart cache, charts will always be downloaded")
+		} else {
+			log.Debug().Msgf("Using chart cache in %s", cache.Dir)
+			pullOptions.Cache = cache
+		}
+	}
+	if config.Offline && pullOptions.Cache == nil {
+		log.Error().Msg("offline mode requires the chart cache")
+		return EXIT_CONFIGURATION_ERROR
+	}
 
-	// Pull the previous installer chart
-	log.Info().Msg("Downloading previous installer chart...")
-	err = helm.Pull(apis.Chart{
+	// Validate the installer version range against the published versions, choosing the previous version if missing
+	installerChart := apis.Chart{
 		Registry:   config.InstallerChartRegistry,
 		Repository: config.InstallerChartRepository,
-		Version:    config.InstallerChartVersionPrevious,
-	})
-	if err != nil {
-		log.Error().Err(err).Msg("there was an error while pulling the previous installer chart")
-		cleanup()
-		return
+		Version:    config.InstallerChartVersion,
+	}
+	versions := []string{config.InstallerChartVersionPrevious, config.InstallerChartVersion}
+	// The order of an explicit range is checked first, since the published versions may not be available
+	if config.InstallerChartVersionPrevious != "" && config.Mode != "backfill" {
+		if err := helm.ValidateRange(config.InstallerChartVersionPrevious, config.InstallerChartVersion); err != nil {
+			log.Error().Err(err).Msg("invalid installer version range")
+			return EXIT_CONFIGURATION_ERROR
+		}
+	}
+	if config.Offline {
+		// The published versions cannot be listed offline, the range must be explicit
+		if config.Mode == "backfill" {
+			log.Error().Msg("backfill mode lists the published installer versions, it cannot run offline")
+			return EXIT_CONFIGURATION_ERROR
+		}
+		if config.InstallerChartVersionPrevious == "" {
+			log.Error().Msg("offline mode requires INSTALLER_CHART_VERSION_PREVIOUS, the previous version cannot be discovered")
+			return EXIT_CONFIGURATION_ERROR
+		}
+		log.Warn().Msg("offline mode, the version range is not validated against the published versions")
+		if config.Mode == "range" {
+			log.Warn().Msg("offline mode, the versions between the two are not compared")
+		}
+	} else if published, err := helm.ListVersions(installerChart, pullOptions); err != nil {
+		if config.InstallerChartVersionPrevious == "" || config.Mode != "release" {
+			log.Error().Err(err).Msg("there was an error while listing the published installer versions")
+			return EXIT_GENERATION_ERROR
+		}
+		log.Warn().Err(err).Msg("could not list the published installer versions, the version range is not validated")
+	} else {
+		// In range mode, every published version between the two is compared to the one preceding it, in backfill mode every published version
+		switch config.Mode {
+		case "backfill":
+			// Only published versions are regenerated
+			config.InstallerChartPath = ""
+			versions = helm.SortVersions(published, config.IncludePrereleases)
+			if len(versions) < 2 {
+				err = fmt.Errorf("at least two published versions are needed, found %d", len(versions))
+			}
+		case "range":
+			versions, err = helm.RangeVersions(config.InstallerChartVersionPrevious, config.InstallerChartVersion, published, config.InstallerChartPath == "", config.IncludePrereleases)
+		default:
+			versions[0], err = helm.ResolvePreviousVersion(config.InstallerChartVersion, config.InstallerChartVersionPrevious, published, config.InstallerChartPath == "", config.IncludePrereleases)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("invalid installer version range")
+			return EXIT_CONFIGURATION_ERROR
+		}
+		if config.InstallerChartVersionPrevious == "" && config.Mode != "backfill" {
+			log.Info().Msgf("Using %s as previous installer version", versions[0])
+		}
+		config.InstallerChartVersionPrevious = versions[0]
 	}
-	// Pull all previous charts to get the appVersion
-	log.Info().Msg("Downloading all charts...")
-	allPreviousCharts, err := helm.ParseValues()
+
+	// Each installer version is extracted in its own directory of the run workspace
+	ws, err := workspace.New(config.KeepWorkspace)
 	if err != nil {
-		log.Error().Err(err).Msg("there was an error while parsing all repositories from the installer chart values file")
-		cleanup()
-		return
-	}
-	log.Debug().Msg("=== Previous Installer Versions")
-	for key := range allPreviousCharts {
-		log.Debug().Msgf("%s: %s", key, allPreviousCharts[key])
-	}
-
-	// Get the removed charts
-	removedChartsTextBuilder := strings.Builder{}
-	removedChartsTextBuilder.WriteString("## Removed Charts\n")
-	for key := range allPreviousCharts {
-		if _, ok := allCharts[key]; !ok {
-			removedChartsTextBuilder.WriteString(fmt.Sprintf("- %s v%s: Removed\n", allPreviousCharts[key].ImageName, allPreviousCharts[key].AppVersion))
-		}
-	}
-
-	// Get the version changes
-	allRangeCharts := map[string]apis.Repoes{}
-	for key := range allCharts {
-		if _, ok := allPreviousCharts[key]; ok {
-			if allCharts[key].ImageName != allPreviousCharts[key].ImageName || allCharts[key].Chart.Registry != allPreviousCharts[key].Chart.Registry || allCharts[key].Chart.Repository != allPreviousCharts[key].Chart.Repository {
-				removedChartsTextBuilder.WriteString(fmt.Sprintf("- %s v%s: Removed\n", allPreviousCharts[key].ImageName, allPreviousCharts[key].AppVersion))
-				allRangeCharts[key] = apis.Repoes{
-					ImageName: allCharts[key].ImageName,
-					Chart: apis.Chart{
-						Repository: allCharts[key].Chart.Repository,
-						Version:    allCharts[key].Chart.Version,
-						AppVersion: allCharts[key].Chart.AppVersion,
-						Registry:   allCharts[key].Chart.Registry,
-					},
-				}
-			} else {
-				allRangeCharts[key] = apis.Repoes{
-					ImageName: allCharts[key].ImageName,
-					Chart: apis.Chart{
-						Repository:         allCharts[key].Chart.Repository,
-						Version:            allCharts[key].Chart.Version,
-						AppVersion:         allCharts[key].Chart.AppVersion,
-						Registry:           allCharts[key].Chart.Registry,
-						AppVersionPrevious: allPreviousCharts[key].Chart.AppVersion,
-					},
-				}
+		log.Error().Err(err).Msg("there was an error while creating the workspace")
+		return EXIT_GENERATION_ERROR
+	}
+	defer ws.Cleanup()
+	ws.CleanupOnSignal()
+
+	generator := notes.NewGenerator(config, clients, pullOptions, ws)
+
+	if config.Mode == "backfill" {
+		log.Info().Msgf("Regenerating the release notes of installer versions %s", versions[1:])
+		hops, failures := generator.Backfill(versions)
+		summary := notes.Summarize(hops, failures...)
+		summary.Log()
+
+		// One file per version, named after the version
+		if err := os.MkdirAll(config.BackfillDir, 0755); err != nil {
+			log.Error().Err(err).Msg("there was an error while creating the backfill directory")
+			return EXIT_GENERATION_ERROR
+		}
+		for _, hop := range hops {
+			log.Info().Msgf("Writing the release notes of %s to file...", hop.Current)
+			err := os.WriteFile(filepath.Join(config.BackfillDir, hop.Current+".md"), []byte(hop.ReleaseNotes), 0644)
+			if err != nil {
+				log.Error().Err(err).Msgf("there was an error while writing the release notes of %s to file", hop.Current)
+				return EXIT_GENERATION_ERROR
 			}
-		} else {
-			allRangeCharts[key] = apis.Repoes{
-				ImageName: allCharts[key].ImageName,
-				Chart: apis.Chart{
-					Repository: allCharts[key].Chart.Repository,
-					Version:    allCharts[key].Chart.Version,
-					AppVersion: allCharts[key].Chart.AppVersion,
-					Registry:   allCharts[key].Chart.Registry,
-				},
+		}
+
+		if len(summary.Failures) > 0 && config.Strict {
+			log.Error().Msgf("%d failures, not rebuilding RELEASE_NOTES.md (unset STRICT to rebuild it anyway)", len(summary.Failures))
+			return EXIT_INCOMPLETE
+		}
+
+		if config.RebuildReleaseNotes {
+			if len(hops) == 0 {
+				log.Error().Msg("no installer version could be compared, not rebuilding RELEASE_NOTES.md")
+				return EXIT_GENERATION_ERROR
+			}
+			downgraded := 0
+			for _, hop := range hops {
+				downgraded += len(hop.Changes.Downgraded)
+			}
+			if downgraded > 0 && !config.AllowDowngrade {
+				log.Error().Msgf("%d components were downgraded, not rebuilding RELEASE_NOTES.md (set ALLOW_DOWNGRADE to rebuild anyway)", downgraded)
+				return EXIT_DOWNGRADE
+			}
+
+			log.Info().Msgf("Rebuilding RELEASE_NOTES.md on repository %s/%s", config.InstallerOrganization, config.KrateoRepository)
+			pullRequest, err := github.RebuildReleaseNotes(clients, notes.ReleaseSections(hops), config)
+			if err != nil {
+				log.Error().Err(err).Msg("there was an error while rebuilding RELEASE_NOTES.md")
+				return EXIT_PUBLISH_ERROR
+			}
+			if pullRequest != "" {
+				log.Info().Msgf("Pull request: %s", pullRequest)
 			}
 		}
+		return EXIT_OK
 	}
 
-	removedChartsText := removedChartsTextBuilder.String()
-	if removedChartsText == "## Removed Charts\n" {
-		removedChartsTextBuilder.WriteString("Nothing removed\n")
-		removedChartsText = removedChartsTextBuilder.String()
+	if config.Mode == "range" {
+		log.Info().Msgf("Comparing installer versions %s", versions)
+		hops, changes, err := generator.CompareRange(versions)
+		if err != nil {
+			log.Error().Err(err).Msg("there was an error while comparing the installer versions")
+			return EXIT_GENERATION_ERROR
+		}
+
+		// The combined release notes are not published, as they do not belong to a single release
+		log.Info().Msg("Writing the release notes to file...")
+		err = os.WriteFile("./release_notes.md", []byte(notes.RangeReleaseNotes(hops, changes)), 0644)
+		if err != nil {
+			log.Error().Err(err).Msg("there was an error while writing the release notes to file")
+			return EXIT_GENERATION_ERROR
+		}
+
+		summary := notes.Summarize(hops)
+		summary.Log()
+		if len(summary.Failures) > 0 && config.Strict {
+			return EXIT_INCOMPLETE
+		}
+		return EXIT_OK
 	}
 
 	// Call the Github API to get the release notes
 	// If config.CreateReleases is set to true, create the release notes for the tag appVersion (if it does not exist)
-	log.Info().Msg("Generating release notes...")
-	finalReleaseNotes := fmt.Sprintf("%s\n%s", removedChartsText, github.GetReleaseNotes(allRangeCharts, config.Tokens, config.Organizations))
+	hop, err := generator.Compare(config.InstallerChartVersionPrevious, config.InstallerChartVersion)
+	if err != nil {
+		log.Error().Err(err).Msg("there was an error while comparing the installer versions")
+		return EXIT_GENERATION_ERROR
+	}
 
 	// Write the result to file
 	log.Info().Msg("Writing the release notes to file...")
-	err = os.WriteFile("./release_notes.md", []byte(finalReleaseNotes), 0644)
+	err = os.WriteFile("./release_notes.md", []byte(hop.ReleaseNotes), 0644)
 	if err != nil {
 		log.Error().Err(err).Msg("there was an error while writing the release notes to file")
-		cleanup()
-		return
+		return EXIT_GENERATION_ERROR
 	}
 
-	// Publish the release notes on a github release for the given repository
-	log.Info().Msgf("Publishing release on installer repository %s/%s:%s", config.Organizations, config.InstallerChartGithubRepository, config.InstallerChartVersion)
-	github.CreateInstallerRelease(finalReleaseNotes, config)
-	cleanup()
-}
+	summary := notes.Summarize([]notes.Hop{hop})
+	summary.Log()
+	if len(summary.Failures) > 0 && config.Strict {
+		log.Error().Msgf("%d failures, not publishing the release (unset STRICT to publish anyway)", len(summary.Failures))
+		return EXIT_INCOMPLETE
+	}
+
+	if len(hop.Changes.Downgraded) > 0 && !config.AllowDowngrade {
+		log.Error().Msgf("%d components were downgraded, not publishing the release (set ALLOW_DOWNGRADE to publish anyway)", len(hop.Changes.Downgraded))
+		return EXIT_DOWNGRADE
+	}
 
-// Cleanup downloaded charts
-func cleanup() {
-	os.RemoveAll("./charts/")
+	// Publish the release notes on a github release for the given repository, or only print the changes in dry run
+	if config.DryRun {
+		log.Info().Msg("Dry run, printing the changes instead of publishing them")
+	}
+	log.Info().Msgf("Publishing release on installer repository %s/%s:%s", config.Organizations, config.InstallerChartGithubRepository, config.InstallerChartVersion)
+	pullRequest, err := github.CreateInstallerRelease(clients, hop.ReleaseNotes, config)
+	// The pull request may be opened even if the release failed
+	if pullRequest != "" {
+		log.Info().Msgf("Pull request: %s", pullRequest)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("there was an error while publishing the release")
+		return EXIT_PUBLISH_ERROR
+	}
+	return EXIT_OK
 }